@@ -1,102 +0,0 @@
-package main
-
-import (
-	"fmt"
-	"time"
-
-	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
-	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
-	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
-	amqp "github.com/rabbitmq/amqp091-go"
-)
-
-func handlerPause(gs *gamelogic.GameState) func(routing.PlayingState) pubsub.AckType {
-	return func(ps routing.PlayingState) pubsub.AckType {
-		defer fmt.Print("> ")
-		gs.HandlePause(ps)
-		return pubsub.Ack
-	}
-}
-
-func handlerMove(gs *gamelogic.GameState, publishCh *amqp.Channel) func(gamelogic.ArmyMove) pubsub.AckType {
-	return func(move gamelogic.ArmyMove) pubsub.AckType {
-		defer fmt.Print("> ")
-		outcome := gs.HandleMove(move)
-		switch outcome {
-		case gamelogic.MoveOutComeSafe:
-			return pubsub.Ack
-		case gamelogic.MoveOutcomeMakeWar:
-			if err := pubsub.PublishJSON(
-				publishCh,
-				routing.ExchangePerilTopic,
-				fmt.Sprintf("%s.%s", routing.WarRecognitionsPrefix, gs.GetUsername()),
-				gamelogic.RecognitionOfWar{
-					Attacker: move.Player,
-					Defender: gs.GetPlayerSnap(),
-				},
-			); err != nil {
-				fmt.Printf("Error: Failed to publish: %v", err)
-				return pubsub.NackRequeue
-			}
-			return pubsub.Ack
-		case gamelogic.MoveOutcomeSamePlayer:
-			return pubsub.NackDiscard
-		default:
-			return pubsub.NackDiscard
-		}
-	}
-}
-
-func handlerWar(gs *gamelogic.GameState, publishCh *amqp.Channel) func(gamelogic.RecognitionOfWar) pubsub.AckType {
-	return func(rw gamelogic.RecognitionOfWar) pubsub.AckType {
-		defer fmt.Print("> ")
-		outcome, winner, loser := gs.HandleWar(rw)
-
-		switch outcome {
-		case gamelogic.WarOutcomeNotInvolved:
-			return pubsub.NackRequeue
-		case gamelogic.WarOutcomeNoUnits:
-			return pubsub.NackDiscard
-		case gamelogic.WarOutcomeOpponentWon:
-			log := routing.GameLog{
-				CurrentTime: time.Now(),
-				Message:     fmt.Sprintf("%s won a war against %s", winner, loser),
-				Username:    gs.GetUsername(),
-			}
-			if err := publishGameLog(log, publishCh); err != nil {
-				return pubsub.NackRequeue
-			}
-
-			return pubsub.Ack
-		case gamelogic.WarOutcomeYouWon:
-			log := routing.GameLog{
-				CurrentTime: time.Now(),
-				Message:     fmt.Sprintf("%s won a war against %s", winner, loser),
-				Username:    gs.GetUsername(),
-			}
-			if err := publishGameLog(log, publishCh); err != nil {
-				return pubsub.NackRequeue
-			}
-
-			return pubsub.Ack
-		case gamelogic.WarOutcomeDraw:
-			log := routing.GameLog{
-				CurrentTime: time.Now(),
-				Message:     fmt.Sprintf("A war between %s and %s resulted in a draw", winner, loser),
-				Username:    gs.GetUsername(),
-			}
-			if err := publishGameLog(log, publishCh); err != nil {
-				return pubsub.NackRequeue
-			}
-
-			return pubsub.Ack
-		default:
-			fmt.Println("Error: Unknown war outcome!")
-			return pubsub.NackDiscard
-		}
-	}
-}
-
-func publishGameLog(log routing.GameLog, publishCh *amqp.Channel) error {
-	return pubsub.PublishGob(publishCh, routing.ExchangePerilTopic, fmt.Sprintf("%s.%s", routing.GameLogSlug, log.Username), log)
-}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/client"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// runLobby lets the player list and join games. It returns the game and a
+// signer for the key the server certified, or false if the player quit
+// instead of joining.
+func runLobby(lb *client.Lobby, conn *amqp.Connection, publishCh *amqp.Channel, username, keyID string, authority *pubsub.Authority) (string, *pubsub.Signer, bool) {
+	if err := client.RequestLobby(publishCh, username); err != nil {
+		fmt.Printf("Failed to request lobby: %v\n", err)
+	}
+	gamelogic.PrintLobbyHelp()
+
+	for {
+		inputWords := gamelogic.GetInput()
+		if inputWords == nil {
+			return "", nil, false
+		}
+		if len(inputWords) == 0 {
+			continue
+		}
+
+		switch inputWords[0] {
+		case "games":
+			gamelogic.PrintLobby(lb.Snap())
+		case "join":
+			if len(inputWords) < 2 {
+				fmt.Println("usage: join <gameID>")
+				continue
+			}
+			g, ok := lb.FindGame(inputWords[1])
+			if !ok {
+				fmt.Printf("Unknown game: %s\n", inputWords[1])
+				continue
+			}
+			if g.Over {
+				fmt.Printf("Game %s is already over.\n", g.ID)
+				continue
+			}
+			signer, err := client.JoinGame(conn, username, keyID, g.ID, authority)
+			if err != nil {
+				fmt.Printf("Failed to join game: %v\n", err)
+				continue
+			}
+			lb.Leave()
+			fmt.Printf("Joined game %s.\n", g.ID)
+			return g.ID, signer, true
+		case "help":
+			gamelogic.PrintLobbyHelp()
+		case "quit":
+			return "", nil, false
+		default:
+			fmt.Printf("Unrecognised command: %s\n", inputWords[0])
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// The memory broker is a baseline for the cost of encoding and fan-out
+// alone: generated messages go straight to consumers of their own, with no
+// server and no network in between.
+
+const memoryGameID = "loadgen"
+
+// envelope stamps each generated message so consumers can measure end-to-end
+// latency.
+type envelope[T any] struct {
+	SentAt  time.Time
+	Payload T
+}
+
+type kind struct {
+	name    string
+	queue   string
+	binding string
+	rate    float64
+	publish func(t *memoryTransport, username string, rng *rand.Rand) error
+	decode  func(body []byte) (time.Time, error)
+}
+
+func decodeJSON[T any](body []byte) (time.Time, error) {
+	var env envelope[T]
+	err := json.Unmarshal(body, &env)
+	return env.SentAt, err
+}
+
+func decodeGob[T any](body []byte) (time.Time, error) {
+	var env envelope[T]
+	err := gob.NewDecoder(bytes.NewReader(body)).Decode(&env)
+	return env.SentAt, err
+}
+
+func randomPlayer(username string, rng *rand.Rand) gamelogic.Player {
+	locs := gamelogic.AllLocations()
+	ranks := gamelogic.AllRanks()
+	units := map[int]gamelogic.Unit{}
+	for id := 1; id <= 5; id++ {
+		units[id] = gamelogic.Unit{
+			ID:       id,
+			Rank:     ranks[rng.Intn(len(ranks))],
+			Location: locs[rng.Intn(len(locs))],
+		}
+	}
+	return gamelogic.Player{Username: username, Units: units, Resources: rng.Intn(50)}
+}
+
+func kinds(cfg config) []kind {
+	return []kind{
+		{
+			name:    "moves",
+			queue:   routing.QueueName(memoryGameID, "moves"),
+			binding: routing.ArmyMovesQueue(memoryGameID),
+			rate:    cfg.moveRate,
+			publish: func(t *memoryTransport, username string, rng *rand.Rand) error {
+				p := randomPlayer(username, rng)
+				move := gamelogic.ArmyMove{Player: gamelogic.Player{Username: username}, Units: []gamelogic.Unit{p.Units[1]}, ToLocation: p.Units[1].Location}
+				return t.publishJSON(routing.ArmyMovesQueue(memoryGameID), envelope[gamelogic.ArmyMove]{SentAt: time.Now(), Payload: move})
+			},
+			decode: decodeJSON[gamelogic.ArmyMove],
+		},
+		{
+			name:    "wars",
+			queue:   routing.QueueName(memoryGameID, "wars"),
+			binding: routing.WarRecognitionsBinding(memoryGameID),
+			rate:    cfg.warRate,
+			publish: func(t *memoryTransport, username string, rng *rand.Rand) error {
+				rw := gamelogic.RecognitionOfWar{
+					Attacker:  randomPlayer("opponent", rng),
+					Defender:  randomPlayer(username, rng),
+					Locations: gamelogic.AllLocations()[:2],
+					Seed:      rng.Int63(),
+				}
+				return t.publishJSON(routing.WarRecognitionsKey(memoryGameID, username), envelope[gamelogic.RecognitionOfWar]{SentAt: time.Now(), Payload: rw})
+			},
+			decode: decodeJSON[gamelogic.RecognitionOfWar],
+		},
+		{
+			name:    "logs",
+			queue:   routing.QueueName(memoryGameID, "logs"),
+			binding: routing.GameLogBinding(),
+			rate:    cfg.logRate,
+			publish: func(t *memoryTransport, username string, rng *rand.Rand) error {
+				gl := routing.GameLog{ID: pubsub.NewMessageID(), CurrentTime: time.Now(), Message: gamelogic.GetMaliciousLog(), Username: username, GameID: memoryGameID, Event: routing.LogEventMessage}
+				return t.publishGob(routing.GameLogKey(memoryGameID, username), envelope[routing.GameLog]{SentAt: time.Now(), Payload: gl})
+			},
+			decode: decodeGob[routing.GameLog],
+		},
+	}
+}
+
+func runMemory(cfg config) {
+	t := newMemoryTransport()
+	defer t.close()
+
+	active := []kind{}
+	for _, k := range kinds(cfg) {
+		if k.rate > 0 {
+			active = append(active, k)
+		}
+	}
+
+	published := map[string]*latencies{}
+	delivered := map[string]*latencies{}
+	for _, k := range active {
+		k := k
+		published[k.name] = newLatencies()
+		delivered[k.name] = newLatencies()
+		if err := t.subscribe(k.queue, k.binding, func(body []byte) {
+			sentAt, err := k.decode(body)
+			if err != nil {
+				delivered[k.name].fail()
+				return
+			}
+			delivered[k.name].record(time.Since(sentAt))
+		}); err != nil {
+			log.Fatalf("Failed to subscribe to %s: %v", k.queue, err)
+		}
+	}
+
+	depths := newDepthStats()
+	sampleDepths := func() {
+		for _, k := range active {
+			if depth, err := t.depth(k.queue); err == nil {
+				depths.record(k.queue, depth)
+			}
+		}
+	}
+	stopSampling := make(chan struct{})
+	go every(4, stopSampling, sampleDepths)
+
+	fmt.Printf("Generating load against the memory broker: %d clients for %v...\n", cfg.clients, cfg.duration)
+	stop := make(chan struct{})
+	wg := &sync.WaitGroup{}
+	start := time.Now()
+	for i := 1; i <= cfg.clients; i++ {
+		username := fmt.Sprintf("loadgen-%d", i)
+		for _, k := range active {
+			k := k
+			rng := rand.New(rand.NewSource(time.Now().UnixNano() + int64(i)))
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				every(k.rate, stop, func() {
+					start := time.Now()
+					if err := k.publish(t, username, rng); err != nil {
+						published[k.name].fail()
+						return
+					}
+					published[k.name].record(time.Since(start))
+				})
+			}()
+		}
+	}
+	time.Sleep(cfg.duration)
+	close(stop)
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	waitFor(cfg.drain, func() bool {
+		for _, k := range active {
+			if delivered[k.name].count() < published[k.name].count() {
+				return false
+			}
+		}
+		return true
+	})
+	close(stopSampling)
+	sampleDepths()
+
+	fmt.Println()
+	fmt.Println("==== Load Report ====")
+	fmt.Printf("broker=memory clients=%d duration=%v\n", cfg.clients, elapsed.Round(time.Millisecond))
+	for _, k := range active {
+		sent, received := published[k.name].count(), delivered[k.name].count()
+		fmt.Printf("%s: sent %d (%.1f/s), received %d, lost %d\n", k.name, sent, float64(sent)/elapsed.Seconds(), received, sent-received)
+		fmt.Printf("  publish latency:     %s\n", published[k.name].summary())
+		fmt.Printf("  end-to-end latency:  %s\n", delivered[k.name].summary())
+		fmt.Printf("  queue depth:         %s\n", depths.summary(k.queue))
+	}
+}
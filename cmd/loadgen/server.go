@@ -0,0 +1,292 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/client"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// The rabbit broker drives a running server the way real clients do: each
+// simulated client registers, joins the game and plays through a
+// client.Session, so every message goes through the server's handlers.
+// Wars aren't generated directly, they break out when moves collide.
+
+// moveClock remembers when each player last moved, so an observer's view of
+// the move can be timed.
+type moveClock struct {
+	mu   *sync.Mutex
+	sent map[string]sentMove
+}
+
+type sentMove struct {
+	to gamelogic.Location
+	at time.Time
+}
+
+func newMoveClock() *moveClock {
+	return &moveClock{mu: &sync.Mutex{}, sent: map[string]sentMove{}}
+}
+
+func (c *moveClock) moved(username string, to gamelogic.Location) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sent[username] = sentMove{to: to, at: time.Now()}
+}
+
+// since returns how long ago the move a view shows was sent. Views of a move
+// the mover has since replaced are not timed.
+func (c *moveClock) since(view gamelogic.ArmyMove) (time.Duration, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	sent, ok := c.sent[view.Player.Username]
+	if !ok || sent.to != view.ToLocation {
+		return 0, false
+	}
+	return time.Since(sent.at), true
+}
+
+// queueDepths reads the depth of the server's queues. A passive declare of
+// a missing queue closes the channel, so it is reopened as needed.
+type queueDepths struct {
+	conn *amqp.Connection
+	ch   *amqp.Channel
+	mu   *sync.Mutex
+}
+
+func (q *queueDepths) depth(queue string) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.ch == nil || q.ch.IsClosed() {
+		ch, err := q.conn.Channel()
+		if err != nil {
+			return 0, err
+		}
+		q.ch = ch
+	}
+	info, err := q.ch.QueueDeclarePassive(queue, false, false, false, false, nil)
+	if err != nil {
+		return 0, err
+	}
+	return info.Messages, nil
+}
+
+type serverStats struct {
+	register *latencies
+	join     *latencies
+	spawns   *latencies
+	moves    *latencies
+	views    *latencies
+	logs     *latencies
+	wars     *atomic.Int64
+}
+
+// joinServer registers a client and joins it to the game, timing both
+// requests. It returns nil if either is refused.
+func joinServer(conn *amqp.Connection, cfg config, username string, clock *moveClock, stats serverStats) *client.Session {
+	start := time.Now()
+	keyID, authority, err := client.Register(conn, username, "", cfg.serverKey)
+	if err != nil {
+		log.Printf("Could not register %s: %v", username, err)
+		stats.register.fail()
+		return nil
+	}
+	stats.register.record(time.Since(start))
+
+	start = time.Now()
+	signer, err := client.JoinGame(conn, username, keyID, cfg.gameID, authority)
+	if err != nil {
+		log.Printf("Could not join %s to %s: %v", username, cfg.gameID, err)
+		stats.join.fail()
+		return nil
+	}
+	stats.join.record(time.Since(start))
+
+	publishCh, err := conn.Channel()
+	if err != nil {
+		log.Fatalf("Failed to open RabbitMQ channel: %v", err)
+	}
+	session := client.NewSession(conn, publishCh, gamelogic.NewGameState(cfg.gameID, username), signer, authority)
+	session.OnMove = func(view gamelogic.ArmyMove) {
+		if d, ok := clock.since(view); ok {
+			stats.views.record(d)
+		}
+	}
+	session.OnWar = func(gamelogic.WarReport) {
+		stats.wars.Add(1)
+	}
+	if err = session.Subscribe(); err != nil {
+		log.Fatalf("Failed to subscribe %s to the game: %v", username, err)
+	}
+	if err = session.Start(); err != nil {
+		log.Fatalf("Failed to announce %s: %v", username, err)
+	}
+	return session
+}
+
+// spawnInfantry asks for an infantry unit in a random location, if the
+// player can afford one.
+func spawnInfantry(s *client.Session, rng *rand.Rand, stats serverStats) {
+	if s.GS.GetPlayerSnap().Resources < gamelogic.RankCost(gamelogic.RankInfantry) {
+		return
+	}
+	locs := gamelogic.AllLocations()
+	start := time.Now()
+	if err := s.Spawn([]string{"spawn", string(locs[rng.Intn(len(locs))]), gamelogic.RankInfantry}); err != nil {
+		stats.spawns.fail()
+		return
+	}
+	stats.spawns.record(time.Since(start))
+}
+
+// moveUnit moves one of the player's units to a random location, if they
+// have any.
+func moveUnit(s *client.Session, rng *rand.Rand, clock *moveClock, stats serverStats) {
+	units := []gamelogic.Unit{}
+	for _, unit := range s.GS.GetPlayerSnap().Units {
+		units = append(units, unit)
+	}
+	if len(units) == 0 {
+		return
+	}
+	unit := units[rng.Intn(len(units))]
+	locs := gamelogic.AllLocations()
+	to := locs[rng.Intn(len(locs))]
+	clock.moved(s.GS.GetUsername(), to)
+	start := time.Now()
+	if _, err := s.Move([]string{"move", string(to), strconv.Itoa(unit.ID)}); err != nil {
+		stats.moves.fail()
+		return
+	}
+	stats.moves.record(time.Since(start))
+}
+
+// publishLog sends a game log, which waits out the client's rate limit like
+// a real client's would.
+func publishLog(s *client.Session, stats serverStats) {
+	start := time.Now()
+	gl := routing.GameLog{CurrentTime: time.Now(), Message: gamelogic.GetMaliciousLog(), Username: s.GS.GetUsername(), GameID: s.GS.GetGameID(), Event: routing.LogEventMessage}
+	if err := s.PublishGameLog(gl); err != nil {
+		stats.logs.fail()
+		return
+	}
+	stats.logs.record(time.Since(start))
+}
+
+func runServer(cfg config) {
+	conn, err := pubsub.Dial(cfg.url)
+	if err != nil {
+		log.Fatalf("RabbitMQ failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	stats := serverStats{
+		register: newLatencies(),
+		join:     newLatencies(),
+		spawns:   newLatencies(),
+		moves:    newLatencies(),
+		views:    newLatencies(),
+		logs:     newLatencies(),
+		wars:     &atomic.Int64{},
+	}
+	clock := newMoveClock()
+
+	// the server holds a name for a while after it is registered, so a run
+	// straight after another can't reuse the previous run's names
+	run := pubsub.NewMessageID()[:6]
+	fmt.Printf("Joining %d clients to game %s...\n", cfg.clients, cfg.gameID)
+	sessions := []*client.Session{}
+	for i := 1; i <= cfg.clients; i++ {
+		if s := joinServer(conn, cfg, fmt.Sprintf("loadgen-%s-%d", run, i), clock, stats); s != nil {
+			sessions = append(sessions, s)
+		}
+	}
+	if len(sessions) == 0 {
+		log.Fatalf("No client could join game %s", cfg.gameID)
+	}
+
+	queues := []string{routing.SpawnQueue(cfg.gameID), routing.ArmyMovesQueue(cfg.gameID), routing.GameLogSlug}
+	qd := &queueDepths{conn: conn, mu: &sync.Mutex{}}
+	depths := newDepthStats()
+	sampleDepths := func() {
+		for _, queue := range queues {
+			if depth, err := qd.depth(queue); err == nil {
+				depths.record(queue, depth)
+			}
+		}
+	}
+	stopSampling := make(chan struct{})
+	go every(4, stopSampling, sampleDepths)
+
+	fmt.Printf("Generating load against the server: %d clients for %v...\n", len(sessions), cfg.duration)
+	stop := make(chan struct{})
+	wg := &sync.WaitGroup{}
+	start := time.Now()
+	for i, s := range sessions {
+		s := s
+		act := func(rate float64, action func(rng *rand.Rand)) {
+			if rate <= 0 {
+				return
+			}
+			rng := rand.New(rand.NewSource(time.Now().UnixNano() + int64(i)))
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				every(rate, stop, func() { action(rng) })
+			}()
+		}
+		act(cfg.spawnRate, func(rng *rand.Rand) { spawnInfantry(s, rng, stats) })
+		act(cfg.moveRate, func(rng *rand.Rand) { moveUnit(s, rng, clock, stats) })
+		act(cfg.logRate, func(*rand.Rand) { publishLog(s, stats) })
+	}
+	time.Sleep(cfg.duration)
+	close(stop)
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	waitFor(cfg.drain, func() bool {
+		for _, queue := range queues {
+			if depth, err := qd.depth(queue); err != nil || depth > 0 {
+				return false
+			}
+		}
+		return true
+	})
+	close(stopSampling)
+	sampleDepths()
+
+	for _, s := range sessions {
+		if err := s.Leave(); err != nil {
+			log.Printf("Failed to announce departure of %s: %v", s.GS.GetUsername(), err)
+		}
+	}
+
+	rate := func(l *latencies) float64 {
+		return float64(l.count()) / elapsed.Seconds()
+	}
+	fmt.Println()
+	fmt.Println("==== Load Report ====")
+	fmt.Printf("broker=rabbit game=%s clients=%d duration=%v\n", cfg.gameID, len(sessions), elapsed.Round(time.Millisecond))
+	fmt.Printf("register latency:      %s\n", stats.register.summary())
+	fmt.Printf("join latency:          %s\n", stats.join.summary())
+	fmt.Printf("spawns: %d (%.1f/s)\n", stats.spawns.count(), rate(stats.spawns))
+	fmt.Printf("  request latency:     %s\n", stats.spawns.summary())
+	fmt.Printf("moves: %d (%.1f/s), %d views received\n", stats.moves.count(), rate(stats.moves), stats.views.count())
+	fmt.Printf("  publish latency:     %s\n", stats.moves.summary())
+	fmt.Printf("  view latency:        %s\n", stats.views.summary())
+	fmt.Printf("wars fought: %d\n", stats.wars.Load())
+	fmt.Printf("logs: %d (%.1f/s)\n", stats.logs.count(), rate(stats.logs))
+	fmt.Printf("  publish latency:     %s\n", stats.logs.summary())
+	for _, queue := range queues {
+		fmt.Printf("queue depth of %s: %s\n", queue, depths.summary(queue))
+	}
+}
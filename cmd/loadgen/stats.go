@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+type latencies struct {
+	mu      *sync.Mutex
+	samples []time.Duration
+	errors  int
+}
+
+func newLatencies() *latencies {
+	return &latencies{mu: &sync.Mutex{}}
+}
+
+func (l *latencies) record(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.samples = append(l.samples, d)
+}
+
+func (l *latencies) fail() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.errors++
+}
+
+func (l *latencies) count() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.samples)
+}
+
+func (l *latencies) summary() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.samples) == 0 {
+		return fmt.Sprintf("n=0 errors=%d", l.errors)
+	}
+	sorted := make([]time.Duration, len(l.samples))
+	copy(sorted, l.samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+	pct := func(p int) time.Duration {
+		return sorted[(len(sorted)-1)*p/100]
+	}
+	return fmt.Sprintf("n=%d errors=%d mean=%v p50=%v p95=%v p99=%v max=%v",
+		len(sorted), l.errors, total/time.Duration(len(sorted)), pct(50), pct(95), pct(99), sorted[len(sorted)-1])
+}
+
+type depthStats struct {
+	mu   *sync.Mutex
+	max  map[string]int
+	last map[string]int
+}
+
+func newDepthStats() *depthStats {
+	return &depthStats{
+		mu:   &sync.Mutex{},
+		max:  map[string]int{},
+		last: map[string]int{},
+	}
+}
+
+func (d *depthStats) record(queue string, depth int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.last[queue] = depth
+	if depth > d.max[queue] {
+		d.max[queue] = depth
+	}
+}
+
+func (d *depthStats) summary(queue string) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return fmt.Sprintf("max=%d final=%d", d.max[queue], d.last[queue])
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// memoryTransport is a minimal in-process topic exchange. It measures the
+// cost of encoding and fan-out without a network hop.
+type memoryTransport struct {
+	mu     *sync.RWMutex
+	queues map[string]*memoryQueue
+}
+
+type memoryQueue struct {
+	binding  string
+	messages chan []byte
+}
+
+const memoryQueueSize = 1 << 16
+
+func newMemoryTransport() *memoryTransport {
+	return &memoryTransport{
+		mu:     &sync.RWMutex{},
+		queues: map[string]*memoryQueue{},
+	}
+}
+
+func (t *memoryTransport) publish(key string, body []byte) error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for _, q := range t.queues {
+		if topicMatches(q.binding, key) {
+			q.messages <- body
+		}
+	}
+	return nil
+}
+
+func (t *memoryTransport) publishJSON(key string, val any) error {
+	body, err := json.Marshal(val)
+	if err != nil {
+		return fmt.Errorf("error marshalling to JSON: %v", err)
+	}
+	return t.publish(key, body)
+}
+
+func (t *memoryTransport) publishGob(key string, val any) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(val); err != nil {
+		return fmt.Errorf("error encoding to Gob: %v", err)
+	}
+	return t.publish(key, buf.Bytes())
+}
+
+func (t *memoryTransport) subscribe(queue, binding string, handler func(body []byte)) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.queues[queue]; ok {
+		return fmt.Errorf("queue %s already exists", queue)
+	}
+	q := &memoryQueue{binding: binding, messages: make(chan []byte, memoryQueueSize)}
+	t.queues[queue] = q
+	go func() {
+		for body := range q.messages {
+			handler(body)
+		}
+	}()
+	return nil
+}
+
+func (t *memoryTransport) depth(queue string) (int, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	q, ok := t.queues[queue]
+	if !ok {
+		return 0, fmt.Errorf("unknown queue %s", queue)
+	}
+	return len(q.messages), nil
+}
+
+func (t *memoryTransport) close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for name, q := range t.queues {
+		close(q.messages)
+		delete(t.queues, name)
+	}
+	return nil
+}
+
+// topicMatches implements AMQP topic matching: "*" matches one word and "#"
+// matches zero or more.
+func topicMatches(binding, key string) bool {
+	return matchWords(strings.Split(binding, "."), strings.Split(key, "."))
+}
+
+func matchWords(binding, key []string) bool {
+	if len(binding) == 0 {
+		return len(key) == 0
+	}
+	switch binding[0] {
+	case "#":
+		for i := 0; i <= len(key); i++ {
+			if matchWords(binding[1:], key[i:]) {
+				return true
+			}
+		}
+		return false
+	case "*":
+		return len(key) > 0 && matchWords(binding[1:], key[1:])
+	default:
+		return len(key) > 0 && key[0] == binding[0] && matchWords(binding[1:], key[1:])
+	}
+}
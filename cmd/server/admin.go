@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// banList is the set of banned usernames, saved to disk on every change.
+type banList struct {
+	mu     *sync.Mutex
+	path   string
+	banned map[string]ban
+}
+
+type ban struct {
+	Reason string    `json:"reason"`
+	Since  time.Time `json:"since"`
+}
+
+func newBanList(path string) (*banList, error) {
+	bl := &banList{
+		mu:     &sync.Mutex{},
+		path:   path,
+		banned: map[string]ban{},
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return bl, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s: %v", path, err)
+	}
+	if err = json.Unmarshal(data, &bl.banned); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %v", path, err)
+	}
+	return bl, nil
+}
+
+// save writes the bans atomically. The caller must hold bl.mu.
+func (bl *banList) save() error {
+	data, err := json.MarshalIndent(bl.banned, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := bl.path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("could not write %s: %v", tmp, err)
+	}
+	return os.Rename(tmp, bl.path)
+}
+
+func (bl *banList) add(username, reason string) error {
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+	prev, had := bl.banned[username]
+	bl.banned[username] = ban{Reason: reason, Since: time.Now()}
+	if err := bl.save(); err != nil {
+		if had {
+			bl.banned[username] = prev
+		} else {
+			delete(bl.banned, username)
+		}
+		return err
+	}
+	return nil
+}
+
+// remove lifts a ban and reports whether there was one.
+func (bl *banList) remove(username string) (bool, error) {
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+	prev, ok := bl.banned[username]
+	if !ok {
+		return false, nil
+	}
+	delete(bl.banned, username)
+	if err := bl.save(); err != nil {
+		bl.banned[username] = prev
+		return false, err
+	}
+	return true, nil
+}
+
+func (bl *banList) isBanned(username string) (ban, bool) {
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+	b, ok := bl.banned[username]
+	return b, ok
+}
+
+// revocationList saves when each removed player's certificates were
+// revoked, so they stay revoked after a restart. Certificates don't expire,
+// so neither do revocations.
+type revocationList struct {
+	mu      *sync.Mutex
+	path    string
+	revoked map[string]time.Time
+}
+
+func newRevocationList(path string) (*revocationList, error) {
+	rl := &revocationList{
+		mu:      &sync.Mutex{},
+		path:    path,
+		revoked: map[string]time.Time{},
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return rl, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s: %v", path, err)
+	}
+	if err = json.Unmarshal(data, &rl.revoked); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %v", path, err)
+	}
+	return rl, nil
+}
+
+// restore reinstates every saved revocation in keys.
+func (rl *revocationList) restore(keys *pubsub.KeyRing) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	for username, at := range rl.revoked {
+		keys.Restore(username, at)
+	}
+}
+
+func (rl *revocationList) add(username string, at time.Time) error {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	prev, had := rl.revoked[username]
+	rl.revoked[username] = at
+	if err := rl.save(); err != nil {
+		if had {
+			rl.revoked[username] = prev
+		} else {
+			delete(rl.revoked, username)
+		}
+		return err
+	}
+	return nil
+}
+
+// save writes the revocations atomically. The caller must hold rl.mu.
+func (rl *revocationList) save() error {
+	data, err := json.MarshalIndent(rl.revoked, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := rl.path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("could not write %s: %v", tmp, err)
+	}
+	return os.Rename(tmp, rl.path)
+}
+
+type bannedUser struct {
+	Username string
+	Reason   string
+	Since    time.Time
+}
+
+func (bl *banList) list() []bannedUser {
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+	banned := []bannedUser{}
+	for username, b := range bl.banned {
+		banned = append(banned, bannedUser{Username: username, Reason: b.Reason, Since: b.Since})
+	}
+	sort.Slice(banned, func(i, j int) bool {
+		return banned[i].Username < banned[j].Username
+	})
+	return banned
+}
+
+func printBans(banned []bannedUser) {
+	if len(banned) == 0 {
+		fmt.Println("Nobody is banned.")
+		return
+	}
+	for _, b := range banned {
+		fmt.Printf("%s: banned since %s", b.Username, b.Since.Format(time.RFC3339))
+		if b.Reason != "" {
+			fmt.Printf(" (%s)", b.Reason)
+		}
+		fmt.Println()
+	}
+}
+
+func banMessage(username string, b ban) string {
+	if b.Reason == "" {
+		return fmt.Sprintf("%s is banned from this server", username)
+	}
+	return fmt.Sprintf("%s is banned from this server: %s", username, b.Reason)
+}
+
+// removePlayer revokes username's certificates so the server ignores
+// anything else they send, even after a restart, drops their registration
+// so they can't rejoin without registering again, tells them they have been
+// kicked or banned, and drops them from every game they were connected to.
+func removePlayer(games *gameRegistry, publishCh *amqp.Channel, username, action, reason string) error {
+	revokedAt := games.keys.Revoke(username)
+	games.users.release(username)
+	if err := games.revocations.add(username, revokedAt); err != nil {
+		return err
+	}
+
+	if err := pubsub.PublishJSON(publishCh, routing.ExchangePerilDirect, routing.AdminKey(username), routing.AdminMessage{
+		Action:  action,
+		Message: reason,
+		Time:    time.Now(),
+	}, pubsub.WithSigner(games.signer)); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, g := range games.all() {
+		if !g.isConnected(username) {
+			continue
+		}
+		status, changed := g.touch(routing.Presence{
+			GameID:   g.id,
+			Username: username,
+			Status:   routing.PresenceLeft,
+			Time:     now,
+		}, now)
+		if !changed {
+			continue
+		}
+		slog.Info("player presence changed", "username", username, "game", g.id, "status", status)
+		if err := publishRosterEvent(g, username, status, publishCh); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func announce(games *gameRegistry, publishCh *amqp.Channel, message string) error {
+	return pubsub.PublishJSON(publishCh, routing.ExchangePerilDirect, routing.AdminBroadcastKey(), routing.AdminMessage{
+		Action:  routing.AdminAnnounce,
+		Message: message,
+		Time:    time.Now(),
+	}, pubsub.WithSigner(games.signer))
+}
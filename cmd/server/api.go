@@ -0,0 +1,186 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+)
+
+// serveAdminAPI serves the admin commands as JSON over HTTP. Every request
+// must carry "Authorization: Bearer <token>".
+func serveAdminAPI(addr, token string, s *server) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/games", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.lobby().Games)
+	})
+	mux.HandleFunc("POST /api/games", func(w http.ResponseWriter, r *http.Request) {
+		var body struct{ ID string }
+		if !readJSON(w, r, &body) {
+			return
+		}
+		info, err := s.createGame(body.ID)
+		respond(w, http.StatusCreated, info, err)
+	})
+	mux.HandleFunc("POST /api/games/{id}/pause", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			At       string
+			Duration string
+			Reason   string
+		}
+		if !readJSON(w, r, &body) {
+			return
+		}
+		req, err := newPauseRequest(body.At, body.Duration, body.Reason, time.Now())
+		if err != nil {
+			writeError(w, invalidf("%v", err))
+			return
+		}
+		ps, err := s.pause(r.PathValue("id"), req)
+		respond(w, http.StatusOK, ps, err)
+	})
+	mux.HandleFunc("POST /api/games/{id}/resume", func(w http.ResponseWriter, r *http.Request) {
+		respond(w, http.StatusNoContent, nil, s.resume(r.PathValue("id")))
+	})
+	mux.HandleFunc("GET /api/games/{id}/standings", func(w http.ResponseWriter, r *http.Request) {
+		standings, err := s.standings(r.PathValue("id"))
+		respond(w, http.StatusOK, standings, err)
+	})
+	mux.HandleFunc("GET /api/players", func(w http.ResponseWriter, r *http.Request) {
+		rosters, err := s.rosters(r.URL.Query().Get("game"))
+		respond(w, http.StatusOK, rosters, err)
+	})
+	mux.HandleFunc("POST /api/players/{username}/kick", func(w http.ResponseWriter, r *http.Request) {
+		var body struct{ Reason string }
+		if !readJSON(w, r, &body) {
+			return
+		}
+		respond(w, http.StatusNoContent, nil, s.kick(r.PathValue("username"), body.Reason))
+	})
+	mux.HandleFunc("GET /api/bans", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.banned())
+	})
+	mux.HandleFunc("PUT /api/bans/{username}", func(w http.ResponseWriter, r *http.Request) {
+		var body struct{ Reason string }
+		if !readJSON(w, r, &body) {
+			return
+		}
+		respond(w, http.StatusNoContent, nil, s.ban(r.PathValue("username"), body.Reason))
+	})
+	mux.HandleFunc("DELETE /api/bans/{username}", func(w http.ResponseWriter, r *http.Request) {
+		respond(w, http.StatusNoContent, nil, s.unban(r.PathValue("username")))
+	})
+	mux.HandleFunc("POST /api/announce", func(w http.ResponseWriter, r *http.Request) {
+		var body struct{ Message string }
+		if !readJSON(w, r, &body) {
+			return
+		}
+		respond(w, http.StatusNoContent, nil, s.announce(body.Message))
+	})
+	mux.HandleFunc("GET /api/logs", func(w http.ResponseWriter, r *http.Request) {
+		// reuse the logs command's filters, e.g. ?user=bob&since=1h
+		words := []string{"logs"}
+		for key, values := range r.URL.Query() {
+			for _, value := range values {
+				words = append(words, key+"="+value)
+			}
+		}
+		q, err := gamelogic.ParseLogQuery(words)
+		if err != nil {
+			writeError(w, invalidf("%v", err))
+			return
+		}
+		page, err := s.queryLogs(q)
+		respond(w, http.StatusOK, page, err)
+	})
+	mux.HandleFunc("GET /api/offenders", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.offenders())
+	})
+	mux.HandleFunc("GET /api/moderation", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.moderationCounts())
+	})
+	mux.HandleFunc("POST /api/moderation/reload", func(w http.ResponseWriter, r *http.Request) {
+		respond(w, http.StatusNoContent, nil, s.reloadModeration())
+	})
+	mux.HandleFunc("GET /api/dlq", func(w http.ResponseWriter, r *http.Request) {
+		limit := defaultDeadLetterLimit
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				writeError(w, invalidf("invalid limit %q", v))
+				return
+			}
+			limit = n
+		}
+		page, err := s.deadLetters(limit)
+		respond(w, http.StatusOK, page, err)
+	})
+
+	return http.ListenAndServe(addr, requireToken(token, mux))
+}
+
+func requireToken(token string, next http.Handler) http.Handler {
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(r.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare(got, want) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSON(w, http.StatusUnauthorized, apiError{Error: "missing or invalid token"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type apiError struct {
+	Error string
+}
+
+// readJSON decodes the request body into v, writing a 400 if it can't. An
+// empty body leaves v unchanged.
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	err := json.NewDecoder(r.Body).Decode(v)
+	if err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, invalidf("invalid request body: %v", err))
+		return false
+	}
+	return true
+}
+
+// respond writes v with status, or the error if the command failed.
+func respond(w http.ResponseWriter, status int, v any, err error) {
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if status == http.StatusNoContent {
+		w.WriteHeader(status)
+		return
+	}
+	writeJSON(w, status, v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	var ce *commandError
+	switch {
+	case errors.As(err, &ce) && ce.notFound:
+		writeJSON(w, http.StatusNotFound, apiError{Error: err.Error()})
+	case errors.As(err, &ce):
+		writeJSON(w, http.StatusBadRequest, apiError{Error: err.Error()})
+	default:
+		slog.Error("admin API request failed", "err", err)
+		writeJSON(w, http.StatusInternalServerError, apiError{Error: err.Error()})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
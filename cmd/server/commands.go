@@ -0,0 +1,293 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/moderation"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// defaultDeadLetterLimit is how many dead letters are shown when no limit is
+// given.
+const defaultDeadLetterLimit = 20
+
+// maxDeadLetterLimit caps how many dead letters one request may show. Each
+// one is taken off the queue and requeued, which counts as a redelivery and
+// keeps the broker busy for as long as the peek takes.
+const maxDeadLetterLimit = 100
+
+// server holds everything the admin commands act on. The REPL and the HTTP
+// API both go through its methods so they behave the same way.
+type server struct {
+	conn            *amqp.Connection
+	publishCh       *amqp.Channel
+	games           *gameRegistry
+	logs            *gamelogic.LogWriter
+	logLimit        *rateLimiter
+	chatLimit       *rateLimiter
+	moderator       *moderation.Moderator
+	bans            *banList
+	deadLetterQueue string
+	hosting         bool
+}
+
+// commandError is a command that failed because of what was asked, rather
+// than because something went wrong on the server.
+type commandError struct {
+	notFound bool
+	msg      string
+}
+
+func (e *commandError) Error() string {
+	return e.msg
+}
+
+func invalidf(format string, args ...any) error {
+	return &commandError{msg: fmt.Sprintf(format, args...)}
+}
+
+func notFoundf(format string, args ...any) error {
+	return &commandError{notFound: true, msg: fmt.Sprintf(format, args...)}
+}
+
+func isCommandError(err error) bool {
+	var ce *commandError
+	return errors.As(err, &ce)
+}
+
+type gameRoster struct {
+	GameID  string
+	Players []routing.RosterEntry
+}
+
+type logPage struct {
+	Page    int
+	Pages   int
+	Total   int
+	Records []gamelogic.LogRecord
+}
+
+type offense struct {
+	Username string
+	Kind     string
+	Dropped  int
+}
+
+type deadLetterPage struct {
+	Queue    string
+	Messages int
+	Letters  []pubsub.DeadLetter
+}
+
+// host refuses commands that need the games when another server hosts them.
+func (s *server) host() error {
+	if !s.hosting {
+		return invalidf("this server isn't hosting games, run the command on the server that is")
+	}
+	return nil
+}
+
+func (s *server) game(id string) (*game, error) {
+	if err := s.host(); err != nil {
+		return nil, err
+	}
+	g, ok := s.games.get(id)
+	if !ok {
+		return nil, notFoundf("unknown game: %s", id)
+	}
+	return g, nil
+}
+
+func (s *server) createGame(id string) (routing.GameInfo, error) {
+	if err := s.host(); err != nil {
+		return routing.GameInfo{}, err
+	}
+	if id == "" {
+		return routing.GameInfo{}, invalidf("missing game ID")
+	}
+	if err := gamelogic.ValidateGameID(id); err != nil {
+		return routing.GameInfo{}, invalidf("%v", err)
+	}
+	if _, ok := s.games.get(id); ok {
+		return routing.GameInfo{}, invalidf("game %s already exists", id)
+	}
+	g, err := startGame(s.conn, s.publishCh, s.games, id)
+	if err != nil {
+		return routing.GameInfo{}, err
+	}
+	return g.info(), nil
+}
+
+func (s *server) lobby() routing.Lobby {
+	return s.games.lobby()
+}
+
+func (s *server) pause(id string, req pauseRequest) (routing.PlayingState, error) {
+	g, err := s.game(id)
+	if err != nil {
+		return routing.PlayingState{}, err
+	}
+	if err = pauseGame(g, s.publishCh, req); err != nil {
+		return routing.PlayingState{}, err
+	}
+	return g.pauseState(), nil
+}
+
+func (s *server) resume(id string) error {
+	g, err := s.game(id)
+	if err != nil {
+		return err
+	}
+	return resumeGame(g, s.publishCh)
+}
+
+func (s *server) standings(id string) ([]routing.Standing, error) {
+	g, err := s.game(id)
+	if err != nil {
+		return nil, err
+	}
+	return g.standings(), nil
+}
+
+// rosters returns the players of one game, or of every game if id is empty.
+func (s *server) rosters(id string) ([]gameRoster, error) {
+	games := s.games.all()
+	if id != "" {
+		g, err := s.game(id)
+		if err != nil {
+			return nil, err
+		}
+		games = []*game{g}
+	}
+	rosters := []gameRoster{}
+	for _, g := range games {
+		rosters = append(rosters, gameRoster{GameID: g.id, Players: g.rosterSnap()})
+	}
+	return rosters, nil
+}
+
+func (s *server) queryLogs(q gamelogic.LogQuery) (logPage, error) {
+	records, total, err := gamelogic.QueryLogs(q)
+	if err != nil {
+		return logPage{}, err
+	}
+	return logPage{
+		Page:    q.Page,
+		Pages:   q.Pages(total),
+		Total:   total,
+		Records: records,
+	}, nil
+}
+
+func (s *server) importLogs(path string) (int, error) {
+	gamelogs, err := gamelogic.ReadTextLogs(path)
+	if err != nil {
+		return 0, invalidf("%v", err)
+	}
+	if err = s.logs.WriteBatch(gamelogs); err != nil {
+		return 0, err
+	}
+	return len(gamelogs), nil
+}
+
+func (s *server) kick(username, reason string) error {
+	if err := s.host(); err != nil {
+		return err
+	}
+	if username == "" {
+		return invalidf("missing username")
+	}
+	return removePlayer(s.games, s.publishCh, username, routing.AdminKick, reason)
+}
+
+func (s *server) ban(username, reason string) error {
+	if err := s.host(); err != nil {
+		return err
+	}
+	if username == "" {
+		return invalidf("missing username")
+	}
+	if err := s.bans.add(username, reason); err != nil {
+		return err
+	}
+	return removePlayer(s.games, s.publishCh, username, routing.AdminBan, reason)
+}
+
+func (s *server) unban(username string) error {
+	if err := s.host(); err != nil {
+		return err
+	}
+	removed, err := s.bans.remove(username)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return notFoundf("%s is not banned", username)
+	}
+	return nil
+}
+
+func (s *server) banned() []bannedUser {
+	return s.bans.list()
+}
+
+func (s *server) announce(message string) error {
+	if err := s.host(); err != nil {
+		return err
+	}
+	if message == "" {
+		return invalidf("missing message")
+	}
+	return announce(s.games, s.publishCh, message)
+}
+
+func (s *server) reloadModeration() error {
+	return s.moderator.Reload()
+}
+
+func (s *server) moderationCounts() []moderation.PlayerCounts {
+	return s.moderator.Counts()
+}
+
+func (s *server) offenders() []offense {
+	offenses := []offense{}
+	for _, rl := range []*rateLimiter{s.logLimit, s.chatLimit} {
+		for _, o := range rl.offenders() {
+			offenses = append(offenses, offense{Username: o.Username, Kind: rl.name, Dropped: o.Dropped})
+		}
+	}
+	return offenses
+}
+
+// deadLetters shows up to limit messages from the dead letter queue without
+// removing them.
+func (s *server) deadLetters(limit int) (deadLetterPage, error) {
+	if limit < 1 || limit > maxDeadLetterLimit {
+		return deadLetterPage{}, invalidf("limit must be between 1 and %d", maxDeadLetterLimit)
+	}
+	letters, messages, err := pubsub.PeekQueue(s.conn, s.deadLetterQueue, limit)
+	if err != nil {
+		return deadLetterPage{}, err
+	}
+	return deadLetterPage{Queue: s.deadLetterQueue, Messages: messages, Letters: letters}, nil
+}
+
+func printDeadLetters(page deadLetterPage) {
+	if len(page.Letters) == 0 {
+		fmt.Printf("%s is empty.\n", page.Queue)
+		return
+	}
+	fmt.Printf("Showing %d of %d messages in %s:\n", len(page.Letters), page.Messages, page.Queue)
+	for _, dl := range page.Letters {
+		fmt.Printf("* %s %s/%s", dl.DeadAt.Format(time.RFC3339), dl.Exchange, dl.RoutingKey)
+		if dl.Reason != "" {
+			fmt.Printf(" (%s from %s, %d times)", dl.Reason, dl.Queue, dl.Count)
+		}
+		fmt.Printf(": %d bytes of %s\n", len(dl.Body), dl.ContentType)
+	}
+}
@@ -0,0 +1,551 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/moderation"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const chatHistorySize = 50
+
+type game struct {
+	id        string
+	mu        *sync.Mutex
+	victory   gamelogic.VictoryConditions
+	roster    map[string]routing.RosterEntry
+	chat      []routing.ChatMessage
+	logs      *gamelogic.LogWriter
+	chatLimit *rateLimiter
+	moderator *moderation.Moderator
+	signer    *pubsub.Signer
+	startedAt time.Time
+	over      bool
+	// pausedFor is the time spent in pauses that have ended, which doesn't
+	// count toward the time limit. limitTimer fires when the limit is next
+	// due.
+	pausedFor  time.Duration
+	limitTimer *time.Timer
+
+	// armies are the server's record of every player's units. contested
+	// holds the wars a defender may declare, one per move of the attacker
+	// into their locations.
+	armies    map[string]*gamelogic.Army
+	contested map[warKey]bool
+
+	// pause is the last pause state announced to the players. pauseTimer
+	// fires the next scheduled pause or resume, if any, and pauseGen counts
+	// pause changes so a timer that fired too late to be stopped stands
+	// down. pauseMu serializes pause changes, which publish outside mu.
+	pause      routing.PlayingState
+	pauseTimer *time.Timer
+	pauseGen   uint64
+	pauseMu    *sync.Mutex
+}
+
+type warKey struct {
+	attacker string
+	defender string
+}
+
+func newGame(id string, victory gamelogic.VictoryConditions, logs *gamelogic.LogWriter, chatLimit *rateLimiter, moderator *moderation.Moderator, signer *pubsub.Signer) *game {
+	return &game{
+		id:        id,
+		logs:      logs,
+		chatLimit: chatLimit,
+		moderator: moderator,
+		signer:    signer,
+		mu:        &sync.Mutex{},
+		pauseMu:   &sync.Mutex{},
+		victory:   victory,
+		armies:    map[string]*gamelogic.Army{},
+		contested: map[warKey]bool{},
+		roster:    map[string]routing.RosterEntry{},
+		startedAt: time.Now(),
+	}
+}
+
+// join adds a player who has no units yet.
+func (g *game) join(username string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.army(username)
+}
+
+// touch records a presence message received at now and returns the status
+// to announce to the other players, if the player's connection state
+// changed. The server's clock is used rather than the message's, so a
+// client can't keep itself connected by claiming a time in the future.
+func (g *game) touch(p routing.Presence, now time.Time) (string, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	entry, known := g.roster[p.Username]
+	wasConnected := known && entry.Connected
+	entry.Username = p.Username
+	entry.LastSeen = now
+	entry.Connected = p.Status != routing.PresenceLeft
+	g.roster[p.Username] = entry
+
+	switch {
+	case entry.Connected && !wasConnected:
+		return routing.PresenceJoined, true
+	case !entry.Connected && wasConnected:
+		return routing.PresenceLeft, true
+	}
+	return "", false
+}
+
+// sweep marks players that have not been seen within timeout as
+// disconnected and returns their usernames.
+func (g *game) sweep(timeout time.Duration, now time.Time) []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	dropped := []string{}
+	for username, entry := range g.roster {
+		if entry.Connected && now.Sub(entry.LastSeen) > timeout {
+			entry.Connected = false
+			g.roster[username] = entry
+			dropped = append(dropped, username)
+		}
+	}
+	return dropped
+}
+
+func (g *game) isConnected(username string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.roster[username].Connected
+}
+
+// recordChat keeps the most recent public messages for late joiners.
+func (g *game) recordChat(msg routing.ChatMessage) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.chat = append(g.chat, msg)
+	if len(g.chat) > chatHistorySize {
+		g.chat = g.chat[len(g.chat)-chatHistorySize:]
+	}
+}
+
+func (g *game) chatHistory() []routing.ChatMessage {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	history := make([]routing.ChatMessage, len(g.chat))
+	copy(history, g.chat)
+	return history
+}
+
+func (g *game) rosterSnap() []routing.RosterEntry {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	roster := []routing.RosterEntry{}
+	for _, entry := range g.roster {
+		roster = append(roster, entry)
+	}
+	sort.Slice(roster, func(i, j int) bool {
+		return roster[i].Username < roster[j].Username
+	})
+	return roster
+}
+
+// spawn gives username a new unit, unless the game is paused or over.
+func (g *game) spawn(spawn gamelogic.Spawn) (gamelogic.Unit, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.over {
+		return gamelogic.Unit{}, errors.New("the game is over")
+	}
+	if g.pause.IsPaused {
+		return gamelogic.Unit{}, errors.New("the game is paused, you can not spawn units")
+	}
+	return g.army(spawn.Username).Spawn(spawn.Location, spawn.Rank)
+}
+
+// applyMove moves the mover's units as recorded, ignoring any they don't
+// have, and returns the units that moved and the mover's army as it stands
+// now. Every player the mover now shares a location with may declare war on
+// them. Nothing moves while the game is paused or over.
+func (g *game) applyMove(move gamelogic.ArmyMove) ([]gamelogic.Unit, gamelogic.Player, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.over {
+		return nil, gamelogic.Player{}, errors.New("the game is over")
+	}
+	if g.pause.IsPaused {
+		return nil, gamelogic.Player{}, errors.New("the game is paused")
+	}
+	army := g.army(move.Player.Username)
+	moved := army.Move(move.Units, move.ToLocation)
+	mover := army.Snap()
+	if len(moved) == 0 {
+		return moved, mover, nil
+	}
+	for username, other := range g.armies {
+		if username != mover.Username && len(gamelogic.ContestedLocations(mover, other.Player)) > 0 {
+			g.contested[warKey{attacker: mover.Username, defender: username}] = true
+		}
+	}
+	return moved, mover, nil
+}
+
+// fight resolves a war the defender declared after a move of the attacker's
+// and removes both sides' losses. The armies and the contested locations are
+// the server's records, not what the defender saw of them, and the seed is
+// the server's own, so a player can't shop for one that wins.
+func (g *game) fight(rw gamelogic.RecognitionOfWar) (gamelogic.WarReport, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.over {
+		return gamelogic.WarReport{}, errors.New("the game is over")
+	}
+	if g.pause.IsPaused {
+		return gamelogic.WarReport{}, errors.New("the game is paused")
+	}
+	key := warKey{attacker: rw.Attacker.Username, defender: rw.Defender.Username}
+	if !g.contested[key] {
+		return gamelogic.WarReport{}, fmt.Errorf("%s has not moved into %s's locations", key.attacker, key.defender)
+	}
+	delete(g.contested, key)
+
+	attacker, defender := g.army(key.attacker), g.army(key.defender)
+	fought := gamelogic.RecognitionOfWar{
+		Attacker: attacker.Snap(),
+		Defender: defender.Snap(),
+		Seed:     rand.Int64(),
+	}
+	fought.Locations = gamelogic.ContestedLocations(fought.Attacker, fought.Defender)
+	report := gamelogic.ResolveWar(fought)
+	attacker.RemoveUnits(report.LossesOf(key.attacker))
+	defender.RemoveUnits(report.LossesOf(key.defender))
+	return report, nil
+}
+
+// collectIncome pays every army its income and returns who earned any.
+func (g *game) collectIncome() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	paid := []string{}
+	if g.over || g.pause.IsPaused {
+		return paid
+	}
+	for username, a := range g.armies {
+		if a.CollectIncome() > 0 {
+			paid = append(paid, username)
+		}
+	}
+	return paid
+}
+
+// army returns username's army, creating it if they have none yet. The
+// caller must hold g.mu.
+func (g *game) army(username string) *gamelogic.Army {
+	a, ok := g.armies[username]
+	if !ok {
+		a = gamelogic.NewArmy(username)
+		g.armies[username] = a
+	}
+	return a
+}
+
+// playerState returns the server's record of username's army.
+func (g *game) playerState(username string) gamelogic.Player {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.army(username).Snap()
+}
+
+// observers returns the army of every player except username.
+func (g *game) observers(username string) []gamelogic.Player {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	observers := []gamelogic.Player{}
+	for _, a := range g.armies {
+		if a.Player.Username != username {
+			observers = append(observers, a.Snap())
+		}
+	}
+	return observers
+}
+
+func (g *game) armiesSnap() []*gamelogic.Army {
+	armies := []*gamelogic.Army{}
+	for _, a := range g.armies {
+		armies = append(armies, a)
+	}
+	return armies
+}
+
+func (g *game) standings() []routing.Standing {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	players := []gamelogic.Player{}
+	for _, a := range g.armies {
+		players = append(players, a.Snap())
+	}
+	return gamelogic.Standings(players)
+}
+
+func (g *game) info() routing.GameInfo {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	players := []string{}
+	for username := range g.armies {
+		players = append(players, username)
+	}
+	sort.Strings(players)
+	return routing.GameInfo{
+		ID:      g.id,
+		Players: players,
+		Victory: g.victory.String(),
+		Paused:  g.pause.IsPaused,
+		Over:    g.over,
+	}
+}
+
+// checkVictory reports a game over at most once.
+// playTime is how long g has been played by now, leaving out pauses. The
+// caller must hold g.mu.
+func (g *game) playTime(now time.Time) time.Duration {
+	played := now.Sub(g.startedAt) - g.pausedFor
+	if g.pause.IsPaused {
+		played -= now.Sub(g.pause.StartedAt)
+	}
+	return played
+}
+
+// timeLeft returns how long is left of the time limit, or false if the
+// clock is stopped because the game is paused or over.
+func (g *game) timeLeft() (time.Duration, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.over || g.pause.IsPaused {
+		return 0, false
+	}
+	return g.victory.TimeLimit - g.playTime(time.Now()), true
+}
+
+// setLimitTimer replaces the timer for the time limit.
+func (g *game) setLimitTimer(t *time.Timer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.limitTimer != nil {
+		g.limitTimer.Stop()
+	}
+	g.limitTimer = t
+}
+
+func (g *game) checkVictory() (routing.GameOver, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.over {
+		return routing.GameOver{}, false
+	}
+	gameOver, ok := gamelogic.CheckVictory(g.victory, g.armiesSnap(), g.playTime(time.Now()))
+	if ok {
+		g.over = true
+	}
+	return gameOver, ok
+}
+
+type gameRegistry struct {
+	mu        *sync.RWMutex
+	games     map[string]*game
+	victory   gamelogic.VictoryConditions
+	logs      *gamelogic.LogWriter
+	chatLimit *rateLimiter
+	moderator *moderation.Moderator
+	keys      *pubsub.KeyRing
+	signer    *pubsub.Signer
+	users     *userRegistry
+	bans      *banList
+	// revocations outlive the server's in-memory record in keys
+	revocations *revocationList
+}
+
+func newGameRegistry(victory gamelogic.VictoryConditions, logs *gamelogic.LogWriter, chatLimit *rateLimiter, moderator *moderation.Moderator, keys *pubsub.KeyRing, users *userRegistry, bans *banList, revocations *revocationList) *gameRegistry {
+	return &gameRegistry{
+		mu:          &sync.RWMutex{},
+		games:       map[string]*game{},
+		victory:     victory,
+		logs:        logs,
+		chatLimit:   chatLimit,
+		moderator:   moderator,
+		keys:        keys,
+		signer:      keys.Signer(),
+		users:       users,
+		bans:        bans,
+		revocations: revocations,
+	}
+}
+
+func (r *gameRegistry) create(id string) (*game, error) {
+	if err := gamelogic.ValidateGameID(id); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.games[id]; ok {
+		return nil, fmt.Errorf("game %s already exists", id)
+	}
+	g := newGame(id, r.victory, r.logs, r.chatLimit, r.moderator, r.signer)
+	r.games[id] = g
+	return g, nil
+}
+
+func (r *gameRegistry) get(id string) (*game, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	g, ok := r.games[id]
+	return g, ok
+}
+
+func (r *gameRegistry) all() []*game {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	games := []*game{}
+	for _, g := range r.games {
+		games = append(games, g)
+	}
+	sort.Slice(games, func(i, j int) bool {
+		return games[i].id < games[j].id
+	})
+	return games
+}
+
+// isConnected reports whether username is connected to any game.
+func (r *gameRegistry) isConnected(username string) bool {
+	for _, g := range r.all() {
+		if g.isConnected(username) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *gameRegistry) lobby() routing.Lobby {
+	lobby := routing.Lobby{Games: []routing.GameInfo{}}
+	for _, g := range r.all() {
+		lobby.Games = append(lobby.Games, g.info())
+	}
+	return lobby
+}
+
+// startGame registers a new game, subscribes to its spawns, moves, wars,
+// presence and chat, and announces it in the lobby. Only messages signed
+// under a certificate issued for this game reach the handlers.
+func startGame(conn *amqp.Connection, publishCh *amqp.Channel, games *gameRegistry, id string) (*game, error) {
+	g, err := games.create(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = pubsub.SubscribeJSONRPC(
+		conn,
+		routing.ExchangeDefault,
+		routing.SpawnQueue(id),
+		routing.SpawnQueue(id),
+		pubsub.Transient,
+		handlerSpawn(g, publishCh),
+		pubsub.WithVerifier(games.keys.ForGame(id)),
+		pubsub.WithReplySigner(g.signer),
+	); err != nil {
+		return nil, fmt.Errorf("failed to subscribe to spawns: %v", err)
+	}
+
+	if err = pubsub.SubscribeJSONContext(
+		conn,
+		routing.ExchangeDefault,
+		routing.ArmyMovesQueue(id),
+		routing.ArmyMovesQueue(id),
+		pubsub.Transient,
+		handlerMove(g, publishCh),
+		pubsub.WithVerifier(games.keys.ForGame(id)),
+	); err != nil {
+		return nil, fmt.Errorf("failed to subscribe to army moves: %v", err)
+	}
+
+	if err = pubsub.SubscribeJSON(
+		conn,
+		routing.ExchangePerilTopic,
+		routing.HostQueue(routing.WarRecognitionsPrefix, id),
+		routing.WarRecognitionsBinding(id),
+		pubsub.Transient,
+		handlerWar(g, publishCh),
+		pubsub.WithVerifier(games.keys.ForGame(id)),
+	); err != nil {
+		return nil, fmt.Errorf("failed to subscribe to war recognitions: %v", err)
+	}
+
+	if err = pubsub.SubscribeJSON(
+		conn,
+		routing.ExchangePerilTopic,
+		routing.HostQueue(routing.PresencePrefix, id),
+		routing.PresenceBinding(id),
+		pubsub.Transient,
+		handlerPresence(g, publishCh),
+		pubsub.WithVerifier(games.keys.ForGame(id)),
+	); err != nil {
+		return nil, fmt.Errorf("failed to subscribe to presence: %v", err)
+	}
+
+	if err = pubsub.SubscribeJSON(
+		conn,
+		routing.ExchangePerilTopic,
+		routing.HostQueue(routing.ChatPrefix, id),
+		routing.ChatBinding(id),
+		pubsub.Transient,
+		handlerChat(g, publishCh),
+		pubsub.WithVerifier(games.keys.ForGame(id)),
+	); err != nil {
+		return nil, fmt.Errorf("failed to subscribe to chat: %v", err)
+	}
+
+	watchTimeLimit(g, publishCh)
+
+	if err = publishLobby(games, publishCh); err != nil {
+		return g, fmt.Errorf("failed to publish lobby: %v", err)
+	}
+	return g, nil
+}
+
+// payIncome pays every player of every game their income and sends them
+// their treasury. Nothing is paid while a game is paused or once it is over.
+func payIncome(games *gameRegistry, publishCh *amqp.Channel) {
+	ticker := time.NewTicker(gamelogic.IncomeInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		for _, g := range games.all() {
+			for _, username := range g.collectIncome() {
+				if err := publishPlayerState(g, username, publishCh); err != nil {
+					slog.Error("failed to publish player state", "username", username, "game", g.id, "err", err)
+				}
+			}
+		}
+	}
+}
+
+// watchPresence periodically drops players whose heartbeats have stopped.
+func watchPresence(games *gameRegistry, publishCh *amqp.Channel, timeout time.Duration) {
+	ticker := time.NewTicker(routing.HeartbeatInterval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		for _, g := range games.all() {
+			for _, username := range g.sweep(timeout, now) {
+				slog.Info("player dropped", "username", username, "game", g.id)
+				if err := publishRosterEvent(g, username, routing.PresenceDisconnected, publishCh); err != nil {
+					slog.Error("failed to publish roster event", "username", username, "game", g.id, "err", err)
+				}
+			}
+		}
+	}
+}
@@ -1,20 +1,407 @@
 package main
 
 import (
+	"context"
+	"crypto/ed25519"
 	"fmt"
+	"log/slog"
+	"time"
 
 	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/moderation"
 	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
 	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	amqp "github.com/rabbitmq/amqp091-go"
 )
 
-func handlerLogs() func(routing.GameLog) pubsub.AckType {
-	return func(gl routing.GameLog) pubsub.AckType {
-		defer fmt.Print("> ")
-		if err := gamelogic.WriteLog(gl); err != nil {
-			fmt.Printf("Error: Failed to write game log: %v", err)
+// handlerLogs writes each batch of game logs. Logs over their sender's rate
+// limit are dead-lettered instead of written, and every log goes through
+// moderation first, whatever event its player says it records. Players may
+// not send the events only the server writes.
+func handlerLogs(logs *gamelogic.LogWriter, limiter *rateLimiter, moderator *moderation.Moderator, publishCh *amqp.Channel) func([]routing.GameLog) []pubsub.AckType {
+	return func(batch []routing.GameLog) []pubsub.AckType {
+		acks := make([]pubsub.AckType, len(batch))
+		allowed := []routing.GameLog{}
+		written := []int{}
+		// what moderation must forget if the batch isn't written, so the
+		// redelivered logs aren't rejected as repeats of themselves
+		retractions := []func(){}
+		for i, gamelog := range batch {
+			if !limiter.allow(gamelog.Username) {
+				acks[i] = pubsub.NackDiscard
+				gameLogResults.With(logEventLabel(gamelog.Event), "rate_limited").Inc()
+				continue
+			}
+
+			if isServerEvent(gamelog.Event) {
+				slog.Warn("rejected game log with a server event", "username", gamelog.Username, "game", gamelog.GameID, "event", gamelog.Event)
+				acks[i] = pubsub.NackDiscard
+				gameLogResults.With(logEventLabel(gamelog.Event), "rejected").Inc()
+				continue
+			}
+
+			message := gamelog.Message
+			result := moderator.Check(gamelog.Username, message)
+			if result.Verdict == moderation.Reject {
+				acks[i] = sendForReview(routing.ReviewKindGameLog, gamelog.GameID, gamelog.Username, message, result.Reason, publishCh)
+				gameLogResults.With(logEventLabel(gamelog.Event), "rejected").Inc()
+				continue
+			}
+			retractions = append(retractions, func() {
+				moderator.Retract(gamelog.Username, message, result)
+			})
+			gamelog.Message = result.Message
+			allowed = append(allowed, gamelog)
+			written = append(written, i)
+		}
+		if len(allowed) == 0 {
+			return acks
+		}
+
+		result := "written"
+		if err := logs.WriteBatch(allowed); err != nil {
+			slog.Error("failed to write game logs", "count", len(allowed), "err", err)
+			for _, i := range written {
+				acks[i] = pubsub.NackRequeue
+			}
+			for _, retract := range retractions {
+				retract()
+			}
+			result = "failed"
+		}
+		for _, gamelog := range allowed {
+			gameLogResults.With(logEventLabel(gamelog.Event), result).Inc()
+		}
+		return acks
+	}
+}
+
+// isServerEvent reports whether only the server writes logs of event.
+func isServerEvent(event string) bool {
+	return event == routing.LogEventGameOver || event == routing.LogEventImported
+}
+
+// sendForReview routes a rejected message to the moderation review queue.
+func sendForReview(kind, gameID, username, message, reason string, publishCh *amqp.Channel) pubsub.AckType {
+	err := pubsub.PublishJSON(publishCh, routing.ExchangePerilTopic, routing.ModerationReviewKey(gameID, username), routing.ModerationReview{
+		Kind:     kind,
+		GameID:   gameID,
+		Username: username,
+		Message:  message,
+		Reason:   reason,
+		Time:     time.Now(),
+	})
+	if err != nil {
+		slog.Error("failed to send message for review", "game", gameID, "username", username, "err", err)
+		return pubsub.NackRequeue
+	}
+	return pubsub.Ack
+}
+
+func handlerLobbyRequest(games *gameRegistry, publishCh *amqp.Channel) func(routing.LobbyRequest) pubsub.AckType {
+	return func(req routing.LobbyRequest) pubsub.AckType {
+		if err := publishLobby(games, publishCh); err != nil {
+			slog.Error("failed to publish lobby", "err", err)
+			return pubsub.NackRequeue
+		}
+		return pubsub.Ack
+	}
+}
+
+func handlerRegistration(games *gameRegistry) func(routing.Registration) (routing.RegistrationResult, pubsub.AckType) {
+	return func(reg routing.Registration) (routing.RegistrationResult, pubsub.AckType) {
+		if b, banned := games.bans.isBanned(reg.Username); banned {
+			slog.Info("rejected registration of banned player", "username", reg.Username)
+			return routing.RegistrationResult{Reason: banMessage(reg.Username, b)}, pubsub.Ack
+		}
+		result := games.users.register(reg, games.isConnected)
+		if !result.Accepted {
+			slog.Info("rejected registration", "username", reg.Username, "reason", result.Reason)
+		}
+		result.ServerKey = games.keys.PublicKey()
+		return result, pubsub.Ack
+	}
+}
+
+// handlerJoinGame certifies the key the player signs their messages with.
+// Only the client that registered a name can join under it.
+func handlerJoinGame(games *gameRegistry, publishCh *amqp.Channel) func(routing.JoinGame) (routing.JoinResult, pubsub.AckType) {
+	return func(join routing.JoinGame) (routing.JoinResult, pubsub.AckType) {
+		log := slog.With("username", join.Username, "game", join.GameID)
+		g, ok := games.get(join.GameID)
+		if !ok {
+			log.Info("player tried to join unknown game")
+			return routing.JoinResult{Reason: fmt.Sprintf("game %s does not exist", join.GameID)}, pubsub.NackDiscard
+		}
+		if b, banned := games.bans.isBanned(join.Username); banned {
+			log.Info("banned player tried to join game")
+			return routing.JoinResult{Reason: banMessage(join.Username, b)}, pubsub.Ack
+		}
+		if g.isConnected(join.Username) {
+			log.Info("player tried to join game while already connected")
+			return routing.JoinResult{Reason: fmt.Sprintf("%s is already connected to game %s", join.Username, join.GameID)}, pubsub.Ack
+		}
+		if !games.users.owns(join.Username, join.KeyID) {
+			return routing.JoinResult{Reason: fmt.Sprintf("%s is not registered to you, register again", join.Username)}, pubsub.Ack
+		}
+		if len(join.PublicKey) != ed25519.PublicKeySize {
+			return routing.JoinResult{Reason: "malformed join request"}, pubsub.NackDiscard
+		}
+
+		cert := games.keys.Issue(join.Username, g.id, join.PublicKey)
+		g.join(join.Username)
+		log.Info("player joined game")
+		if err := publishLobby(games, publishCh); err != nil {
+			log.Error("failed to publish lobby", "err", err)
+		}
+		return routing.JoinResult{Accepted: true, Certificate: cert}, pubsub.Ack
+	}
+}
+
+// handlerSpawn records a spawn and replies with the unit the server issued.
+// The spawner's client adds the unit only once it is accepted.
+func handlerSpawn(g *game, publishCh *amqp.Channel) func(gamelogic.Spawn) (gamelogic.SpawnResult, pubsub.AckType) {
+	return func(spawn gamelogic.Spawn) (gamelogic.SpawnResult, pubsub.AckType) {
+		unit, err := g.spawn(spawn)
+		if err != nil {
+			return gamelogic.SpawnResult{Reason: err.Error()}, pubsub.Ack
+		}
+		endIfWon(g, publishCh)
+		return gamelogic.SpawnResult{Accepted: true, Unit: unit, Resources: g.playerState(spawn.Username).Resources}, pubsub.Ack
+	}
+}
+
+// handlerMove sends every other player only the part of a move they can
+// observe, in the move's trace. Only units the server knows the mover has
+// move, and the rest of the mover's army comes from the server's own record.
+func handlerMove(g *game, publishCh *amqp.Channel) func(context.Context, gamelogic.ArmyMove) pubsub.AckType {
+	return func(ctx context.Context, move gamelogic.ArmyMove) pubsub.AckType {
+		moved, mover, err := g.applyMove(move)
+		if err != nil {
+			slog.Warn("rejected move", "game", g.id, "username", move.Player.Username, "err", err)
+			return pubsub.NackDiscard
+		}
+		if len(moved) == 0 {
+			slog.Warn("rejected move of unknown units", "game", g.id, "username", move.Player.Username)
+			return pubsub.NackDiscard
+		}
+		move.Units = moved
+		for _, observer := range g.observers(move.Player.Username) {
+			view := gamelogic.MoveView(move, mover, observer)
+			if err := pubsub.PublishJSON(publishCh, routing.ExchangePerilTopic, routing.ArmyMoveViewKey(g.id, observer.Username), view, pubsub.WithContext(ctx), pubsub.WithSigner(g.signer)); err != nil {
+				slog.Error("failed to publish move view", "game", g.id, "username", observer.Username, "err", err)
+				return pubsub.NackRequeue
+			}
+		}
+		if err := publishPlayerState(g, move.Player.Username, publishCh); err != nil {
+			slog.Error("failed to publish player state", "game", g.id, "username", move.Player.Username, "err", err)
+		}
+		relayedMoves.With(g.id).Inc()
+		endIfWon(g, publishCh)
+		return pubsub.Ack
+	}
+}
+
+// handlerWar fights every war a defender declares on the server's own armies,
+// so the casualties and eliminations don't depend on either player's word.
+// Both sides are sent their armies afterwards in case their own result
+// differs.
+func handlerWar(g *game, publishCh *amqp.Channel) func(gamelogic.RecognitionOfWar) pubsub.AckType {
+	return func(rw gamelogic.RecognitionOfWar) pubsub.AckType {
+		report, err := g.fight(rw)
+		if err != nil {
+			slog.Warn("rejected war", "game", g.id, "attacker", rw.Attacker.Username, "defender", rw.Defender.Username, "err", err)
+			return pubsub.NackDiscard
+		}
+		slog.Info("war resolved", "game", g.id, "attacker", report.Attacker, "defender", report.Defender, "seed", report.Seed, "winner", report.Winner())
+		for _, username := range []string{report.Attacker, report.Defender} {
+			if err := publishPlayerState(g, username, publishCh); err != nil {
+				slog.Error("failed to publish player state", "game", g.id, "username", username, "err", err)
+			}
+		}
+		endIfWon(g, publishCh)
+		return pubsub.Ack
+	}
+}
+
+// publishPlayerState sends username the server's record of their army.
+func publishPlayerState(g *game, username string, publishCh *amqp.Channel) error {
+	return pubsub.PublishJSON(publishCh, routing.ExchangePerilDirect, routing.PlayerStateKey(g.id, username), g.playerState(username), pubsub.WithSigner(g.signer))
+}
+
+func handlerPresence(g *game, publishCh *amqp.Channel) func(routing.Presence) pubsub.AckType {
+	return func(p routing.Presence) pubsub.AckType {
+		if p.Status != routing.PresenceLeft {
+			g.join(p.Username)
+		}
+		status, changed := g.touch(p, time.Now())
+		if !changed {
+			return pubsub.Ack
+		}
+		log := slog.With("username", p.Username, "game", g.id)
+		log.Info("player presence changed", "status", status)
+		if err := publishRosterEvent(g, p.Username, status, publishCh); err != nil {
+			log.Error("failed to publish roster event", "err", err)
+			return pubsub.NackRequeue
+		}
+		if status == routing.PresenceJoined {
+			if err := sendChatHistory(g, p.Username, publishCh); err != nil {
+				log.Error("failed to send chat history", "err", err)
+			}
+		}
+		return pubsub.Ack
+	}
+}
+
+func handlerChat(g *game, publishCh *amqp.Channel) func(routing.ChatMessage) pubsub.AckType {
+	return func(msg routing.ChatMessage) pubsub.AckType {
+		msg.GameID = g.id
+		msg.History = false
+
+		if !g.chatLimit.allow(msg.From) {
+			notice := routing.ChatMessage{
+				GameID:  g.id,
+				From:    "server",
+				To:      msg.From,
+				Message: "you are sending messages too fast, slow down",
+				Time:    time.Now(),
+			}
+			if err := pubsub.PublishJSON(publishCh, routing.ExchangePerilTopic, routing.ChatDirectKey(g.id, msg.From), notice, pubsub.WithSigner(g.signer)); err != nil {
+				slog.Error("failed to send chat notice", "game", g.id, "username", msg.From, "err", err)
+			}
+			return pubsub.NackDiscard
+		}
+
+		message := msg.Message
+		result := g.moderator.Check(msg.From, message)
+		if result.Verdict == moderation.Reject {
+			notice := routing.ChatMessage{
+				GameID:  g.id,
+				From:    "server",
+				To:      msg.From,
+				Message: fmt.Sprintf("your message was not delivered: %s", result.Reason),
+				Time:    time.Now(),
+			}
+			if err := pubsub.PublishJSON(publishCh, routing.ExchangePerilTopic, routing.ChatDirectKey(g.id, msg.From), notice, pubsub.WithSigner(g.signer)); err != nil {
+				slog.Error("failed to send chat notice", "game", g.id, "username", msg.From, "err", err)
+			}
+			return sendForReview(routing.ReviewKindChat, g.id, msg.From, msg.Message, result.Reason, publishCh)
+		}
+		msg.Message = result.Message
+
+		if msg.To == "" {
+			if err := pubsub.PublishJSON(publishCh, routing.ExchangePerilTopic, routing.ChatBroadcastKey(g.id), msg, pubsub.WithSigner(g.signer)); err != nil {
+				slog.Error("failed to relay chat", "game", g.id, "username", msg.From, "err", err)
+				g.moderator.Retract(msg.From, message, result)
+				return pubsub.NackRequeue
+			}
+			g.recordChat(msg)
+			return pubsub.Ack
+		}
+
+		if !g.isConnected(msg.To) {
+			notice := routing.ChatMessage{
+				GameID:  g.id,
+				From:    "server",
+				To:      msg.From,
+				Message: fmt.Sprintf("%s is not connected to this game", msg.To),
+				Time:    time.Now(),
+			}
+			if err := pubsub.PublishJSON(publishCh, routing.ExchangePerilTopic, routing.ChatDirectKey(g.id, msg.From), notice, pubsub.WithSigner(g.signer)); err != nil {
+				slog.Error("failed to send chat notice", "game", g.id, "username", msg.From, "err", err)
+			}
+			return pubsub.NackDiscard
+		}
+
+		if err := pubsub.PublishJSON(publishCh, routing.ExchangePerilTopic, routing.ChatDirectKey(g.id, msg.To), msg, pubsub.WithSigner(g.signer)); err != nil {
+			slog.Error("failed to relay whisper", "game", g.id, "username", msg.From, "to", msg.To, "err", err)
+			g.moderator.Retract(msg.From, message, result)
 			return pubsub.NackRequeue
 		}
 		return pubsub.Ack
 	}
 }
+
+func sendChatHistory(g *game, username string, publishCh *amqp.Channel) error {
+	for _, msg := range g.chatHistory() {
+		msg.History = true
+		if err := pubsub.PublishJSON(publishCh, routing.ExchangePerilTopic, routing.ChatDirectKey(g.id, username), msg, pubsub.WithSigner(g.signer)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func publishRosterEvent(g *game, username, status string, publishCh *amqp.Channel) error {
+	return pubsub.PublishJSON(publishCh, routing.ExchangePerilTopic, routing.RosterKey(g.id), routing.Presence{
+		GameID:   g.id,
+		Username: username,
+		Status:   status,
+		Time:     time.Now(),
+	}, pubsub.WithSigner(g.signer))
+}
+
+func publishLobby(games *gameRegistry, publishCh *amqp.Channel) error {
+	return pubsub.PublishJSON(publishCh, routing.ExchangePerilTopic, routing.LobbyStateKey, games.lobby(), pubsub.WithSigner(games.signer))
+}
+
+func announceGameOver(g *game, gameOver routing.GameOver, publishCh *amqp.Channel) error {
+	fmt.Println()
+	fmt.Printf("==== Game Over: %s ====\n", g.id)
+	fmt.Println(gameOver.Reason)
+	fmt.Println(gamelogic.FormatStandings(gameOver.Standings))
+
+	if err := pubsub.PublishJSON(publishCh, routing.ExchangePerilTopic, routing.GameOverKey(g.id), gameOver, pubsub.WithSigner(g.signer)); err != nil {
+		return err
+	}
+	gamesOver.Inc()
+
+	return g.logs.WriteLog(routing.GameLog{
+		ID:          pubsub.NewMessageID(),
+		CurrentTime: gameOver.EndedAt,
+		Message:     fmt.Sprintf("game over: %s; final standings: %s", gameOver.Reason, formatStandingsLine(gameOver.Standings)),
+		Username:    "server",
+		GameID:      g.id,
+		Event:       routing.LogEventGameOver,
+	})
+}
+
+func formatStandingsLine(standings []routing.Standing) string {
+	line := ""
+	for i, s := range standings {
+		if i > 0 {
+			line += ", "
+		}
+		line += fmt.Sprintf("%d. %s (%d)", i+1, s.Username, s.Score)
+	}
+	return line
+}
+
+// watchTimeLimit ends g once it has been played for its time limit. The
+// clock stops while the game is paused, and resuming calls it again.
+func watchTimeLimit(g *game, publishCh *amqp.Channel) {
+	if g.victory.TimeLimit <= 0 {
+		return
+	}
+	left, ok := g.timeLeft()
+	if !ok {
+		return
+	}
+	if left <= 0 {
+		endIfWon(g, publishCh)
+		return
+	}
+	g.setLimitTimer(time.AfterFunc(left, func() {
+		watchTimeLimit(g, publishCh)
+	}))
+}
+
+// endIfWon announces the end of the game if its victory conditions are met.
+func endIfWon(g *game, publishCh *amqp.Channel) {
+	if gameOver, ok := g.checkVictory(); ok {
+		defer fmt.Print("> ")
+		if err := announceGameOver(g, gameOver, publishCh); err != nil {
+			slog.Error("failed to announce game over", "game", g.id, "err", err)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/metrics"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+var (
+	relayedMoves = metrics.NewCounterVec(
+		"peril_server_moves_total",
+		"Army moves relayed to observers, by game.",
+		"game",
+	)
+	gameLogResults = metrics.NewCounterVec(
+		"peril_server_game_logs_total",
+		"Game logs received, by event and whether they were written, rate_limited, rejected or failed.",
+		"event", "result",
+	)
+	gamesOver = metrics.NewCounter(
+		"peril_server_games_over_total",
+		"Games that have ended.",
+	)
+)
+
+// logEventLabel is the event label for a game log. Players choose the event
+// they send, so anything unknown is counted as other rather than adding a
+// series.
+func logEventLabel(event string) string {
+	switch event {
+	case "":
+		return routing.LogEventMessage
+	case routing.LogEventMessage, routing.LogEventWar, routing.LogEventDiplomacy, routing.LogEventGameOver, routing.LogEventImported:
+		return event
+	}
+	return "other"
+}
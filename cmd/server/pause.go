@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// pauseRequest is a parsed pause command. A zero At pauses now and a zero
+// Duration pauses until the game is resumed by hand.
+type pauseRequest struct {
+	At       time.Time
+	Duration time.Duration
+	Reason   string
+}
+
+// parsePause parses the arguments after the game ID:
+//
+//	[at <time>] [duration] [reason...]
+//
+// where time is RFC 3339 or a 24-hour clock time such as 18:30, which means
+// the next time the clock reads it.
+func parsePause(words []string, now time.Time) (pauseRequest, error) {
+	var at, duration string
+	if len(words) > 0 && words[0] == "at" {
+		if len(words) < 2 {
+			return pauseRequest{}, fmt.Errorf("missing time after at")
+		}
+		at = words[1]
+		words = words[2:]
+	}
+	if len(words) > 0 {
+		if _, err := time.ParseDuration(words[0]); err == nil {
+			duration = words[0]
+			words = words[1:]
+		}
+	}
+	return newPauseRequest(at, duration, strings.Join(words, " "), now)
+}
+
+// newPauseRequest builds a pause request from its text fields, any of which
+// may be empty.
+func newPauseRequest(at, duration, reason string, now time.Time) (pauseRequest, error) {
+	req := pauseRequest{Reason: reason}
+	if at != "" {
+		t, err := parsePauseTime(at, now)
+		if err != nil {
+			return pauseRequest{}, err
+		}
+		req.At = t
+	}
+	if duration != "" {
+		d, err := time.ParseDuration(duration)
+		if err != nil {
+			return pauseRequest{}, fmt.Errorf("invalid duration %q", duration)
+		}
+		if d <= 0 {
+			return pauseRequest{}, fmt.Errorf("duration must be positive")
+		}
+		req.Duration = d
+	}
+	return req, nil
+}
+
+func parsePauseTime(s string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		if !t.After(now) {
+			return time.Time{}, fmt.Errorf("%s is in the past", s)
+		}
+		return t, nil
+	}
+	clock, err := time.ParseInLocation("15:04", s, now.Location())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, want RFC 3339 or HH:MM", s)
+	}
+	t := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, now.Location())
+	if !t.After(now) {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// setPause records ps and replaces any pending pause or resume with next,
+// starting a new pause generation. The pause being replaced, if any, is
+// added to the time the game has spent paused. The caller must hold
+// g.pauseMu.
+func (g *game) setPause(ps routing.PlayingState, next *time.Timer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.pauseTimer != nil {
+		g.pauseTimer.Stop()
+	}
+	if g.pause.IsPaused {
+		g.pausedFor += time.Since(g.pause.StartedAt)
+	}
+	g.pause = ps
+	g.pauseTimer = next
+	g.pauseGen++
+}
+
+func (g *game) pauseState() routing.PlayingState {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.pause
+}
+
+func (g *game) pauseGeneration() uint64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.pauseGen
+}
+
+// afterPause runs fn with g.pauseMu held after d, unless the pause has
+// changed by then. Stopping the timer is not enough: it may already have
+// fired and be waiting for the lock. The caller must hold g.pauseMu and pass
+// the timer to setPause.
+func (g *game) afterPause(d time.Duration, fn func()) *time.Timer {
+	gen := g.pauseGeneration() + 1
+	return time.AfterFunc(d, func() {
+		g.pauseMu.Lock()
+		defer g.pauseMu.Unlock()
+		if g.pauseGeneration() != gen {
+			return
+		}
+		fn()
+	})
+}
+
+func publishPause(g *game, publishCh *amqp.Channel, ps routing.PlayingState) error {
+	return pubsub.PublishJSON(publishCh, routing.ExchangePerilDirect, routing.PauseKey(g.id), ps, pubsub.WithSigner(g.signer))
+}
+
+// pauseGame pauses g now, or announces a pause at req.At and starts it then.
+// A pause with a duration resumes on its own.
+func pauseGame(g *game, publishCh *amqp.Channel, req pauseRequest) error {
+	g.pauseMu.Lock()
+	defer g.pauseMu.Unlock()
+	return startPause(g, publishCh, req)
+}
+
+// startPause does the work of pauseGame. The caller must hold g.pauseMu.
+func startPause(g *game, publishCh *amqp.Channel, req pauseRequest) error {
+	now := time.Now()
+	if !req.At.IsZero() && req.At.After(now) {
+		ps := routing.PlayingState{Reason: req.Reason, StartedAt: req.At}
+		if req.Duration > 0 {
+			ps.ResumeAt = req.At.Add(req.Duration)
+		}
+		if err := publishPause(g, publishCh, ps); err != nil {
+			return err
+		}
+		g.setPause(ps, g.afterPause(req.At.Sub(now), func() {
+			req.At = time.Time{}
+			if err := startPause(g, publishCh, req); err != nil {
+				slog.Error("failed to start scheduled pause", "game", g.id, "err", err)
+				return
+			}
+			slog.Info("scheduled pause started", "game", g.id)
+		}))
+		return nil
+	}
+
+	ps := routing.PlayingState{IsPaused: true, Reason: req.Reason, StartedAt: now}
+	var resume *time.Timer
+	if req.Duration > 0 {
+		ps.ResumeAt = now.Add(req.Duration)
+		resume = g.afterPause(req.Duration, func() {
+			if err := endPause(g, publishCh); err != nil {
+				slog.Error("failed to resume game", "game", g.id, "err", err)
+				return
+			}
+			slog.Info("resumed game", "game", g.id, "after", req.Duration)
+		})
+	}
+	if err := publishPause(g, publishCh, ps); err != nil {
+		if resume != nil {
+			resume.Stop()
+		}
+		return err
+	}
+	g.setPause(ps, resume)
+	return nil
+}
+
+// resumeGame resumes g and cancels any pending pause or resume.
+func resumeGame(g *game, publishCh *amqp.Channel) error {
+	g.pauseMu.Lock()
+	defer g.pauseMu.Unlock()
+	return endPause(g, publishCh)
+}
+
+// endPause does the work of resumeGame. The caller must hold g.pauseMu.
+func endPause(g *game, publishCh *amqp.Channel) error {
+	ps := routing.PlayingState{IsPaused: false}
+	if err := publishPause(g, publishCh, ps); err != nil {
+		return err
+	}
+	g.setPause(ps, nil)
+	watchTimeLimit(g, publishCh)
+	return nil
+}
+
+func describePause(ps routing.PlayingState) string {
+	var when string
+	switch {
+	case ps.IsScheduled():
+		when = fmt.Sprintf("pausing at %s", ps.StartedAt.Format(time.Kitchen))
+	case ps.IsPaused:
+		when = "paused"
+	default:
+		return "not paused"
+	}
+	if !ps.ResumeAt.IsZero() {
+		when += fmt.Sprintf(", resuming at %s", ps.ResumeAt.Format(time.Kitchen))
+	}
+	if ps.Reason != "" {
+		when += fmt.Sprintf(" (%s)", ps.Reason)
+	}
+	return when
+}
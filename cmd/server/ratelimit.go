@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+)
+
+const (
+	// sweepInterval is how often idle buckets are dropped.
+	sweepInterval = time.Minute
+	// offenderTTL is how long a player is listed as an offender after their
+	// last dropped message.
+	offenderTTL = time.Hour
+)
+
+// rateLimiter keeps a token bucket per username and counts what it drops.
+// A rate of zero or less disables it. Buckets that have refilled are
+// dropped, since a new bucket would behave the same, and offenders are
+// forgotten offenderTTL after their last dropped message.
+type rateLimiter struct {
+	name     string
+	mu       *sync.Mutex
+	rate     float64
+	burst    int
+	buckets  map[string]*pubsub.TokenBucket
+	dropped  map[string]drops
+	limiting map[string]bool
+	swept    time.Time
+}
+
+type drops struct {
+	count int
+	last  time.Time
+}
+
+type offender struct {
+	Username string
+	Dropped  int
+}
+
+func newRateLimiter(name string, rate float64, burst int) (*rateLimiter, error) {
+	if rate > 0 && burst < 1 {
+		return nil, fmt.Errorf("%s burst must be at least 1, got %d", name, burst)
+	}
+	return &rateLimiter{
+		name:     name,
+		mu:       &sync.Mutex{},
+		rate:     rate,
+		burst:    burst,
+		buckets:  map[string]*pubsub.TokenBucket{},
+		dropped:  map[string]drops{},
+		limiting: map[string]bool{},
+		swept:    time.Now(),
+	}, nil
+}
+
+// allow reports whether username may send another message. The first drop
+// after a player was within their limit is reported on the console.
+func (rl *rateLimiter) allow(username string) bool {
+	if rl.rate <= 0 {
+		return true
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(rl.swept) >= sweepInterval {
+		rl.sweep(now)
+	}
+
+	bucket, ok := rl.buckets[username]
+	if !ok {
+		bucket = pubsub.NewTokenBucket(rl.rate, rl.burst)
+		rl.buckets[username] = bucket
+	}
+	if bucket.Allow() {
+		rl.limiting[username] = false
+		return true
+	}
+
+	rl.dropped[username] = drops{count: rl.dropped[username].count + 1, last: now}
+	if !rl.limiting[username] {
+		rl.limiting[username] = true
+		slog.Warn("player is over the rate limit, dropping the excess", "username", username, "kind", rl.name)
+	}
+	return false
+}
+
+// sweep drops the buckets of players who have been quiet long enough to
+// refill, and forgets old offenders. The caller must hold rl.mu.
+func (rl *rateLimiter) sweep(now time.Time) {
+	for username, bucket := range rl.buckets {
+		if bucket.Full() {
+			delete(rl.buckets, username)
+			delete(rl.limiting, username)
+		}
+	}
+	for username, d := range rl.dropped {
+		if now.Sub(d.last) > offenderTTL {
+			delete(rl.dropped, username)
+		}
+	}
+	rl.swept = now
+}
+
+// offenders returns the players who have had messages dropped within the
+// last offenderTTL, worst first.
+func (rl *rateLimiter) offenders() []offender {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	now := time.Now()
+	offenders := []offender{}
+	for username, d := range rl.dropped {
+		if now.Sub(d.last) > offenderTTL {
+			continue
+		}
+		offenders = append(offenders, offender{Username: username, Dropped: d.count})
+	}
+	sort.Slice(offenders, func(i, j int) bool {
+		if offenders[i].Dropped != offenders[j].Dropped {
+			return offenders[i].Dropped > offenders[j].Dropped
+		}
+		return offenders[i].Username < offenders[j].Username
+	})
+	return offenders
+}
+
+func printOffenders(offenses []offense) {
+	if len(offenses) == 0 {
+		fmt.Println("No players have been rate limited.")
+		return
+	}
+	for _, o := range offenses {
+		fmt.Printf("%s: %d %s dropped\n", o.Username, o.Dropped, o.Kind)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+const passwordIterations = 100000
+
+// userRegistry hands out usernames. A name is in use while its registration
+// is fresh or its player is connected to a game. Names registered with a
+// password are reserved for good and saved to disk.
+type userRegistry struct {
+	mu           *sync.Mutex
+	path         string
+	ttl          time.Duration
+	reservations map[string]reservation
+	passwords    map[string]passwordHash
+}
+
+type reservation struct {
+	keyID string
+	at    time.Time
+}
+
+type passwordHash struct {
+	Salt string `json:"salt"`
+	Hash string `json:"hash"`
+}
+
+// newUserRegistry loads the reserved names from path, if it exists.
+func newUserRegistry(path string, ttl time.Duration) (*userRegistry, error) {
+	users := &userRegistry{
+		mu:           &sync.Mutex{},
+		path:         path,
+		ttl:          ttl,
+		reservations: map[string]reservation{},
+		passwords:    map[string]passwordHash{},
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return users, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s: %v", path, err)
+	}
+	if err = json.Unmarshal(data, &users.passwords); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %v", path, err)
+	}
+	return users, nil
+}
+
+// hashPassword stretches password with PBKDF2-HMAC-SHA256 (one block).
+func hashPassword(password string, salt []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(password))
+	mac.Write(salt)
+	mac.Write([]byte{0, 0, 0, 1})
+	u := mac.Sum(nil)
+	out := append([]byte{}, u...)
+	for i := 1; i < passwordIterations; i++ {
+		mac.Reset()
+		mac.Write(u)
+		u = mac.Sum(nil)
+		for j := range out {
+			out[j] ^= u[j]
+		}
+	}
+	return out
+}
+
+func newPasswordHash(password string) (passwordHash, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return passwordHash{}, err
+	}
+	return passwordHash{
+		Salt: hex.EncodeToString(salt),
+		Hash: hex.EncodeToString(hashPassword(password, salt)),
+	}, nil
+}
+
+func (ph passwordHash) matches(password string) bool {
+	salt, err := hex.DecodeString(ph.Salt)
+	if err != nil {
+		return false
+	}
+	want, err := hex.DecodeString(ph.Hash)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(hashPassword(password, salt), want)
+}
+
+// save writes the reserved names atomically. The caller must hold u.mu.
+func (u *userRegistry) save() error {
+	data, err := json.MarshalIndent(u.passwords, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := u.path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("could not write %s: %v", tmp, err)
+	}
+	return os.Rename(tmp, u.path)
+}
+
+// register claims reg.Username under a new key ID, which only the
+// registering client learns. connected reports whether a player of that name
+// is connected to any game.
+func (u *userRegistry) register(reg routing.Registration, connected func(string) bool) routing.RegistrationResult {
+	if err := gamelogic.ValidateUsername(reg.Username); err != nil {
+		return routing.RegistrationResult{Reason: err.Error()}
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	now := time.Now()
+	if hash, ok := u.passwords[reg.Username]; ok {
+		// the owner of a reserved name may take it over, e.g. after a crash
+		if reg.Password == "" {
+			return routing.RegistrationResult{Reason: fmt.Sprintf("%s is reserved, enter its password", reg.Username)}
+		}
+		if !hash.matches(reg.Password) {
+			return routing.RegistrationResult{Reason: fmt.Sprintf("wrong password for %s", reg.Username)}
+		}
+	} else {
+		r, ok := u.reservations[reg.Username]
+		if (ok && now.Sub(r.at) < u.ttl) || connected(reg.Username) {
+			return routing.RegistrationResult{Reason: fmt.Sprintf("%s is already in use, pick another name", reg.Username)}
+		}
+		if reg.Password != "" {
+			hash, err := newPasswordHash(reg.Password)
+			if err != nil {
+				return routing.RegistrationResult{Reason: "could not reserve name, try again"}
+			}
+			u.passwords[reg.Username] = hash
+			if err = u.save(); err != nil {
+				delete(u.passwords, reg.Username)
+				slog.Error("failed to save reserved names", "err", err)
+				return routing.RegistrationResult{Reason: "could not reserve name, try again"}
+			}
+		}
+	}
+
+	keyID := pubsub.NewMessageID()
+	u.reservations[reg.Username] = reservation{keyID: keyID, at: now}
+	return routing.RegistrationResult{Accepted: true, KeyID: keyID}
+}
+
+// owns reports whether keyID is username's current registration.
+func (u *userRegistry) owns(username, keyID string) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	r, ok := u.reservations[username]
+	return ok && r.keyID == keyID
+}
+
+// release drops username's registration, so its key ID can't join games.
+// A reserved name keeps its password.
+func (u *userRegistry) release(username string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	delete(u.reservations, username)
+}
@@ -0,0 +1,130 @@
+package bot
+
+import (
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/client"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+)
+
+// Bot plays a session on its own, issuing the same spawn and move commands
+// a human would type.
+type Bot struct {
+	session  *client.Session
+	strategy Strategy
+	rng      *rand.Rand
+	mu       *sync.Mutex
+	enemies  map[string]gamelogic.Player
+}
+
+// New wires the bot's hooks into the session. It must be called before the
+// session subscribes.
+func New(session *client.Session, strategy Strategy) *Bot {
+	b := &Bot{
+		session:  session,
+		strategy: strategy,
+		rng:      rand.New(rand.NewSource(time.Now().UnixNano())),
+		mu:       &sync.Mutex{},
+		enemies:  map[string]gamelogic.Player{},
+	}
+	session.OnMove = b.sawMove
+	session.OnWar = b.foughtWar
+	return b
+}
+
+func (b *Bot) Username() string {
+	return b.session.GS.GetUsername()
+}
+
+// sawMove merges what the bot could see of a move into what it already
+// knows about the mover. A view only shows part of the mover's army, so
+// units seen earlier elsewhere are kept.
+func (b *Bot) sawMove(move gamelogic.ArmyMove) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	enemy, ok := b.enemies[move.Player.Username]
+	if !ok {
+		enemy = gamelogic.Player{Username: move.Player.Username, Units: map[int]gamelogic.Unit{}}
+	}
+	for id, unit := range move.Player.Units {
+		enemy.Units[id] = unit
+	}
+	for _, unit := range move.Units {
+		enemy.Units[unit.ID] = unit
+	}
+	b.enemies[enemy.Username] = enemy
+}
+
+// foughtWar forgets the opponent units that died.
+func (b *Bot) foughtWar(report gamelogic.WarReport) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, username := range []string{report.Attacker, report.Defender} {
+		enemy, ok := b.enemies[username]
+		if !ok {
+			continue
+		}
+		for _, unit := range report.LossesOf(username) {
+			delete(enemy.Units, unit.ID)
+		}
+	}
+}
+
+func (b *Bot) world() World {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	enemies := map[string]gamelogic.Player{}
+	for username, p := range b.enemies {
+		enemies[username] = gamelogic.PlayerView(p, gamelogic.AllLocations()...)
+	}
+	return World{
+		Self:    b.session.GS.GetPlayerSnap(),
+		Enemies: enemies,
+	}
+}
+
+// Run takes a turn every interval until the game ends or stop is closed.
+func (b *Bot) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		gs := b.session.GS
+		if gs.IsOver() {
+			fmt.Printf("[%s] the game is over\n", b.Username())
+			return
+		}
+		if gs.IsPaused() {
+			continue
+		}
+
+		words := b.strategy.Act(b.world(), b.rng)
+		if len(words) == 0 {
+			continue
+		}
+		fmt.Printf("[%s] %s\n", b.Username(), strings.Join(words, " "))
+
+		var err error
+		switch words[0] {
+		case "spawn":
+			err = b.session.Spawn(words)
+		case "move":
+			_, err = b.session.Move(words)
+		default:
+			err = fmt.Errorf("strategy %s issued unknown command %s", b.strategy.Name(), words[0])
+		}
+		if err != nil {
+			slog.Warn("bot command failed", "username", b.Username(), "strategy", b.strategy.Name(), "command", strings.Join(words, " "), "err", err)
+		}
+	}
+}
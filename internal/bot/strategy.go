@@ -0,0 +1,193 @@
+package bot
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+)
+
+// World is what a bot knows when it takes a turn: its own army and the last
+// units it saw of each opponent.
+type World struct {
+	Self    gamelogic.Player
+	Enemies map[string]gamelogic.Player
+}
+
+// enemyPowerAt sums the power of every opponent unit last seen in loc.
+func (w World) enemyPowerAt(loc gamelogic.Location) int {
+	power := 0
+	for _, enemy := range w.Enemies {
+		power += gamelogic.PowerAt(enemy, loc)
+	}
+	return power
+}
+
+// Strategy decides a bot's next command. It returns the command words as a
+// player would type them, or nil to skip the turn.
+type Strategy interface {
+	Name() string
+	Act(w World, rng *rand.Rand) []string
+}
+
+func NewStrategy(name string) (Strategy, error) {
+	switch name {
+	case "random":
+		return randomStrategy{}, nil
+	case "aggressive":
+		return aggressiveStrategy{}, nil
+	case "defensive":
+		return defensiveStrategy{}, nil
+	}
+	return nil, fmt.Errorf("unknown strategy %q, expected random, aggressive or defensive", name)
+}
+
+func StrategyNames() []string {
+	return []string{"random", "aggressive", "defensive"}
+}
+
+func spawn(loc gamelogic.Location, rank gamelogic.UnitRank) []string {
+	return []string{"spawn", string(loc), string(rank)}
+}
+
+func move(loc gamelogic.Location, units []gamelogic.Unit) []string {
+	words := []string{"move", string(loc)}
+	for _, unit := range units {
+		words = append(words, strconv.Itoa(unit.ID))
+	}
+	return words
+}
+
+// bestAffordable returns the most expensive rank the player can pay for.
+func bestAffordable(p gamelogic.Player) (gamelogic.UnitRank, bool) {
+	ranks := gamelogic.AllRanks()
+	for i := len(ranks) - 1; i >= 0; i-- {
+		if gamelogic.RankCost(ranks[i]) <= p.Resources {
+			return ranks[i], true
+		}
+	}
+	return "", false
+}
+
+func sortedUnits(p gamelogic.Player) []gamelogic.Unit {
+	units := []gamelogic.Unit{}
+	for _, unit := range p.Units {
+		units = append(units, unit)
+	}
+	sort.Slice(units, func(i, j int) bool {
+		return units[i].ID < units[j].ID
+	})
+	return units
+}
+
+func randomLocation(rng *rand.Rand) gamelogic.Location {
+	locs := gamelogic.AllLocations()
+	return locs[rng.Intn(len(locs))]
+}
+
+// randomStrategy spawns and moves without any plan.
+type randomStrategy struct{}
+
+func (randomStrategy) Name() string { return "random" }
+
+func (randomStrategy) Act(w World, rng *rand.Rand) []string {
+	units := sortedUnits(w.Self)
+	if len(units) == 0 || rng.Intn(2) == 0 {
+		ranks := []gamelogic.UnitRank{}
+		for _, rank := range gamelogic.AllRanks() {
+			if gamelogic.RankCost(rank) <= w.Self.Resources {
+				ranks = append(ranks, rank)
+			}
+		}
+		if len(ranks) > 0 {
+			return spawn(randomLocation(rng), ranks[rng.Intn(len(ranks))])
+		}
+	}
+	if len(units) == 0 {
+		return nil
+	}
+	return move(randomLocation(rng), []gamelogic.Unit{units[rng.Intn(len(units))]})
+}
+
+// aggressiveStrategy builds the strongest units it can afford and throws its
+// whole army at the weakest opponent stack it has seen.
+type aggressiveStrategy struct{}
+
+func (aggressiveStrategy) Name() string { return "aggressive" }
+
+func (aggressiveStrategy) Act(w World, rng *rand.Rand) []string {
+	target, targetPower := gamelogic.Location(""), 0
+	for _, loc := range gamelogic.AllLocations() {
+		power := w.enemyPowerAt(loc)
+		if power > 0 && (target == "" || power < targetPower) {
+			target, targetPower = loc, power
+		}
+	}
+	if target == "" {
+		target = randomLocation(rng)
+	}
+
+	units := sortedUnits(w.Self)
+	ownPower := 0
+	for _, loc := range gamelogic.AllLocations() {
+		ownPower += gamelogic.PowerAt(w.Self, loc)
+	}
+
+	if rank, ok := bestAffordable(w.Self); ok && (len(units) == 0 || ownPower <= targetPower) {
+		return spawn(target, rank)
+	}
+
+	attackers := []gamelogic.Unit{}
+	for _, unit := range units {
+		if unit.Location != target {
+			attackers = append(attackers, unit)
+		}
+	}
+	if len(attackers) == 0 {
+		return nil
+	}
+	return move(target, attackers)
+}
+
+// defensiveStrategy never attacks. It holds one home location, pulls its
+// units back there and reinforces it with cheap infantry.
+type defensiveStrategy struct{}
+
+func (defensiveStrategy) Name() string { return "defensive" }
+
+func (defensiveStrategy) Act(w World, rng *rand.Rand) []string {
+	counts := map[gamelogic.Location]int{}
+	home := gamelogic.Location("")
+	for _, unit := range sortedUnits(w.Self) {
+		counts[unit.Location]++
+		if home == "" || counts[unit.Location] > counts[home] {
+			home = unit.Location
+		}
+	}
+	if home == "" {
+		home = randomLocation(rng)
+	}
+
+	strays := []gamelogic.Unit{}
+	for _, unit := range sortedUnits(w.Self) {
+		if unit.Location != home {
+			strays = append(strays, unit)
+		}
+	}
+	if len(strays) > 0 {
+		return move(home, strays)
+	}
+
+	rank := gamelogic.UnitRank(gamelogic.RankInfantry)
+	if w.enemyPowerAt(home) > gamelogic.PowerAt(w.Self, home) {
+		if best, ok := bestAffordable(w.Self); ok {
+			rank = best
+		}
+	}
+	if gamelogic.RankCost(rank) > w.Self.Resources {
+		return nil
+	}
+	return spawn(home, rank)
+}
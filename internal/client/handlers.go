@@ -0,0 +1,201 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+func handlerPause(gs *gamelogic.GameState) func(routing.PlayingState) pubsub.AckType {
+	return func(ps routing.PlayingState) pubsub.AckType {
+		defer fmt.Print("> ")
+		gs.HandlePause(ps)
+		return pubsub.Ack
+	}
+}
+
+func handlerGameOver(gs *gamelogic.GameState) func(routing.GameOver) pubsub.AckType {
+	return func(gameOver routing.GameOver) pubsub.AckType {
+		defer fmt.Print("> ")
+		gs.HandleGameOver(gameOver)
+		return pubsub.Ack
+	}
+}
+
+// handlerAdmin ignores kicks and bans sent before the player joined, which
+// can only be old messages replayed to remove them again.
+func handlerAdmin(s *Session) func(routing.AdminMessage) pubsub.AckType {
+	return func(msg routing.AdminMessage) pubsub.AckType {
+		if msg.Action != routing.AdminAnnounce && msg.Time.Before(s.signer.IssuedAt()) {
+			s.log.Warn("ignored stale admin message", "action", msg.Action, "sent_at", msg.Time)
+			return pubsub.NackDiscard
+		}
+		defer fmt.Print("> ")
+		if s.GS.HandleAdminMessage(msg) && s.OnKick != nil {
+			s.OnKick(msg)
+		}
+		return pubsub.Ack
+	}
+}
+
+func handlerPlayerState(gs *gamelogic.GameState) func(gamelogic.Player) pubsub.AckType {
+	return func(p gamelogic.Player) pubsub.AckType {
+		if gs.HandlePlayerState(p) > 0 {
+			fmt.Print("> ")
+		}
+		return pubsub.Ack
+	}
+}
+
+func handlerRoster(gs *gamelogic.GameState) func(routing.Presence) pubsub.AckType {
+	return func(p routing.Presence) pubsub.AckType {
+		if gs.HandleRosterEvent(p) {
+			fmt.Print("> ")
+		}
+		return pubsub.Ack
+	}
+}
+
+func handlerChat(gs *gamelogic.GameState) func(routing.ChatMessage) pubsub.AckType {
+	return func(msg routing.ChatMessage) pubsub.AckType {
+		if gs.HandleChat(msg) {
+			fmt.Print("> ")
+		}
+		return pubsub.Ack
+	}
+}
+
+func handlerDiplomacy(gs *gamelogic.GameState) func(gamelogic.Diplomacy) pubsub.AckType {
+	return func(d gamelogic.Diplomacy) pubsub.AckType {
+		if gs.HandleDiplomacy(d) {
+			fmt.Print("> ")
+		}
+		return pubsub.Ack
+	}
+}
+
+// handlerMove declares war on moves into our locations. The recognition of
+// war is published in the move's trace.
+func handlerMove(s *Session) func(context.Context, gamelogic.ArmyMove) pubsub.AckType {
+	return func(ctx context.Context, move gamelogic.ArmyMove) pubsub.AckType {
+		defer fmt.Print("> ")
+		gs := s.GS
+		outcome := gs.HandleMove(move)
+		if s.OnMove != nil {
+			defer s.OnMove(move)
+		}
+		switch outcome {
+		case gamelogic.MoveOutComeSafe:
+			return pubsub.Ack
+		case gamelogic.MoveOutcomeMakeWar:
+			rw, report := gs.DeclareWar(move)
+			if err := pubsub.PublishJSON(
+				s.publishCh,
+				routing.ExchangePerilTopic,
+				routing.WarRecognitionsKey(gs.GetGameID(), gs.GetUsername()),
+				rw,
+				pubsub.WithContext(ctx),
+				pubsub.WithSigner(s.signer),
+			); err != nil {
+				s.log.Error("failed to publish recognition of war", "err", err)
+				return pubsub.NackRequeue
+			}
+			if s.OnWar != nil {
+				s.OnWar(report)
+			}
+			return pubsub.Ack
+		case gamelogic.MoveOutcomeSamePlayer:
+			return pubsub.NackDiscard
+		default:
+			return pubsub.NackDiscard
+		}
+	}
+}
+
+// handlerWar resolves our side of a war and logs the result in the war's
+// trace.
+func handlerWar(s *Session) func(context.Context, gamelogic.RecognitionOfWar) pubsub.AckType {
+	return func(ctx context.Context, rw gamelogic.RecognitionOfWar) pubsub.AckType {
+		defer fmt.Print("> ")
+		gs := s.GS
+		outcome, report := gs.HandleWar(rw)
+
+		switch outcome {
+		case gamelogic.WarOutcomeNotInvolved:
+			return pubsub.NackRequeue
+		case gamelogic.WarOutcomeNoUnits:
+			return pubsub.NackDiscard
+		case gamelogic.WarOutcomeOpponentWon, gamelogic.WarOutcomeYouWon, gamelogic.WarOutcomeDraw:
+			if s.OnWar != nil {
+				s.OnWar(report)
+			}
+
+			log := routing.GameLog{
+				CurrentTime: time.Now(),
+				Message:     report.Summary(),
+				Username:    gs.GetUsername(),
+				GameID:      gs.GetGameID(),
+				Event:       routing.LogEventWar,
+			}
+			if err := s.publishGameLog(ctx, log); err != nil {
+				return pubsub.NackRequeue
+			}
+
+			return pubsub.Ack
+		default:
+			s.log.Error("unknown war outcome", "outcome", int(outcome))
+			return pubsub.NackDiscard
+		}
+	}
+}
+
+func (s *Session) publishGameLog(ctx context.Context, log routing.GameLog) error {
+	if log.ID == "" {
+		log.ID = pubsub.NewMessageID()
+	}
+	return pubsub.PublishGob(s.publishCh, routing.ExchangePerilTopic, routing.GameLogKey(log.GameID, log.Username), log, pubsub.WithContext(ctx), pubsub.WithSigner(s.signer))
+}
+
+func (s *Session) publishPresence(status string) error {
+	return pubsub.PublishJSON(s.publishCh, routing.ExchangePerilTopic, routing.PresenceKey(s.GS.GetGameID(), s.GS.GetUsername()), routing.Presence{
+		GameID:   s.GS.GetGameID(),
+		Username: s.GS.GetUsername(),
+		Status:   status,
+		Time:     time.Now(),
+	}, pubsub.WithSigner(s.signer))
+}
+
+func (s *Session) sendHeartbeats() {
+	ticker := time.NewTicker(routing.HeartbeatInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := s.publishPresence(routing.PresenceHeartbeat); err != nil {
+			s.log.Warn("failed to publish heartbeat", "err", err)
+		}
+	}
+}
+
+func (s *Session) publishChat(msg routing.ChatMessage) error {
+	return pubsub.PublishJSON(s.publishCh, routing.ExchangePerilTopic, routing.ChatKey(msg.GameID, msg.From), msg, pubsub.WithSigner(s.signer))
+}
+
+func (s *Session) publishDiplomacy(d gamelogic.Diplomacy) error {
+	if err := pubsub.PublishJSON(s.publishCh, routing.ExchangePerilTopic, routing.DiplomacyKey(s.GS.GetGameID(), d.From), d, pubsub.WithSigner(s.signer)); err != nil {
+		return err
+	}
+	msg, ok := gamelogic.DiplomacyLogMessage(d)
+	if !ok {
+		return nil
+	}
+	return s.publishGameLog(context.Background(), routing.GameLog{
+		CurrentTime: time.Now(),
+		Message:     msg,
+		Username:    s.GS.GetUsername(),
+		GameID:      s.GS.GetGameID(),
+		Event:       routing.LogEventDiplomacy,
+	})
+}
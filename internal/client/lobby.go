@@ -0,0 +1,115 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const joinTimeout = 5 * time.Second
+
+// Lobby holds the latest list of games broadcast by the server.
+type Lobby struct {
+	mu      *sync.Mutex
+	latest  routing.Lobby
+	inLobby bool
+}
+
+func NewLobby() *Lobby {
+	return &Lobby{
+		mu:      &sync.Mutex{},
+		inLobby: true,
+	}
+}
+
+func (lb *Lobby) update(l routing.Lobby) bool {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	lb.latest = l
+	return lb.inLobby
+}
+
+func (lb *Lobby) Snap() routing.Lobby {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	return lb.latest
+}
+
+// Leave stops printing lobby updates once the player has joined a game.
+func (lb *Lobby) Leave() {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	lb.inLobby = false
+}
+
+func (lb *Lobby) FindGame(id string) (routing.GameInfo, bool) {
+	for _, g := range lb.Snap().Games {
+		if g.ID == id {
+			return g, true
+		}
+	}
+	return routing.GameInfo{}, false
+}
+
+func handlerLobby(lb *Lobby) func(routing.Lobby) pubsub.AckType {
+	return func(l routing.Lobby) pubsub.AckType {
+		if lb.update(l) {
+			defer fmt.Print("> ")
+			fmt.Println()
+			gamelogic.PrintLobby(l)
+		}
+		return pubsub.Ack
+	}
+}
+
+func SubscribeLobby(conn *amqp.Connection, username string, lb *Lobby, authority *pubsub.Authority) error {
+	return pubsub.SubscribeJSON(
+		conn,
+		routing.ExchangePerilTopic,
+		routing.QueueName(routing.LobbyPrefix, username),
+		routing.LobbyStateKey,
+		pubsub.Transient,
+		handlerLobby(lb),
+		pubsub.WithVerifier(authority.Server()),
+	)
+}
+
+// RequestLobby asks the server to broadcast the list of games.
+func RequestLobby(publishCh *amqp.Channel, username string) error {
+	return pubsub.PublishJSON(publishCh, routing.ExchangePerilTopic, routing.LobbyRequestKey(username), routing.LobbyRequest{Username: username})
+}
+
+// JoinGame asks the server to join gameID with the key ID from Register. It
+// generates the player's key and returns a signer for it, under the
+// certificate the server issued.
+func JoinGame(conn *amqp.Connection, username, keyID, gameID string, authority *pubsub.Authority) (*pubsub.Signer, error) {
+	pub, priv, err := pubsub.NewKey()
+	if err != nil {
+		return nil, err
+	}
+	result, err := pubsub.RequestJSON[routing.JoinGame, routing.JoinResult](
+		conn,
+		routing.ExchangeDefault,
+		routing.LobbyJoinQueue(),
+		routing.JoinGame{GameID: gameID, Username: username, KeyID: keyID, PublicKey: pub},
+		joinTimeout,
+		pubsub.WithReplyVerifier(authority.Server()),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if !result.Accepted {
+		return nil, errors.New(result.Reason)
+	}
+	cert := result.Certificate
+	if cert.Username != username || cert.GameID != gameID || !pub.Equal(cert.PublicKey) {
+		return nil, errors.New("server certified the wrong key")
+	}
+	return pubsub.NewPlayerSigner(priv, cert), nil
+}
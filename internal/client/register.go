@@ -0,0 +1,58 @@
+package client
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Register claims username with the server. It returns the key ID the
+// player must join games with and an Authority for the server's public key,
+// or the server's reason for refusing. If serverKey is set, the server must
+// prove it holds that key; otherwise the key the server sends is trusted.
+func Register(conn *amqp.Connection, username, password string, serverKey ed25519.PublicKey) (string, *pubsub.Authority, error) {
+	opts := []pubsub.RequestOption{}
+	if serverKey != nil {
+		opts = append(opts, pubsub.WithReplyVerifier(pubsub.NewAuthority(serverKey, pubsub.DefaultMaxSignatureAge).Server()))
+	}
+	result, err := pubsub.RequestJSON[routing.Registration, routing.RegistrationResult](
+		conn,
+		routing.ExchangeDefault,
+		routing.RegistrationQueue(),
+		routing.Registration{Username: username, Password: password},
+		joinTimeout,
+		opts...,
+	)
+	if err != nil {
+		return "", nil, err
+	}
+	if !result.Accepted {
+		return "", nil, errors.New(result.Reason)
+	}
+	if serverKey != nil && !bytes.Equal(result.ServerKey, serverKey) {
+		return "", nil, errors.New("server sent a different key than the one given")
+	}
+	if len(result.ServerKey) != ed25519.PublicKeySize || result.KeyID == "" {
+		return "", nil, errors.New("server sent a malformed registration")
+	}
+	return result.KeyID, pubsub.NewAuthority(result.ServerKey, pubsub.DefaultMaxSignatureAge), nil
+}
+
+// ParseServerKey decodes a hex public key given to pin the server's key. An
+// empty key returns nil, to trust whatever key the server sends.
+func ParseServerKey(s string) (ed25519.PublicKey, error) {
+	if s == "" {
+		return nil, nil
+	}
+	key, err := hex.DecodeString(s)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("want %d hex-encoded bytes", ed25519.PublicKeySize)
+	}
+	return key, nil
+}
@@ -0,0 +1,294 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const spawnTimeout = 5 * time.Second
+
+// Session is a player taking part in one game. The interactive client and
+// the bots both play through a Session so they share the same subscriptions.
+type Session struct {
+	GS        *gamelogic.GameState
+	conn      *amqp.Connection
+	publishCh *amqp.Channel
+	signer    *pubsub.Signer
+	authority *pubsub.Authority
+	log       *slog.Logger
+
+	// logThrottle keeps the player's own game logs under the server's rate
+	// limit.
+	logThrottle *pubsub.TokenBucket
+
+	// OnMove and OnWar are optional hooks called after the game state has
+	// handled an opponent's move or a war.
+	OnMove func(gamelogic.ArmyMove)
+	OnWar  func(gamelogic.WarReport)
+
+	// OnKick is an optional hook called after the player has been kicked or
+	// banned by the server admin.
+	OnKick func(routing.AdminMessage)
+}
+
+// NewSession signs everything it publishes with signer, which holds the key
+// the server certified when the player joined. Everything it receives must
+// be signed by the server, or by another player of the game under a
+// certificate from authority.
+func NewSession(conn *amqp.Connection, publishCh *amqp.Channel, gs *gamelogic.GameState, signer *pubsub.Signer, authority *pubsub.Authority) *Session {
+	return &Session{
+		GS:          gs,
+		conn:        conn,
+		publishCh:   publishCh,
+		signer:      signer,
+		authority:   authority,
+		log:         slog.With("username", gs.GetUsername(), "game", gs.GetGameID()),
+		logThrottle: pubsub.NewTokenBucket(routing.GameLogRate, routing.GameLogBurst),
+	}
+}
+
+// Subscribe binds the player's queues for the game. Hooks must be set before
+// calling it.
+func (s *Session) Subscribe() error {
+	gameID, username := s.GS.GetGameID(), s.GS.GetUsername()
+
+	if err := pubsub.SubscribeJSON(
+		s.conn,
+		routing.ExchangePerilDirect,
+		routing.QueueName(routing.PausePrefix, gameID, username),
+		routing.PauseKey(gameID),
+		pubsub.Transient,
+		handlerPause(s.GS),
+		pubsub.WithVerifier(s.authority.Server()),
+	); err != nil {
+		return fmt.Errorf("failed to subscribe to pause: %v", err)
+	}
+	s.log.Debug("subscribed to pause")
+
+	if err := pubsub.SubscribeJSON(
+		s.conn,
+		routing.ExchangePerilDirect,
+		routing.QueueName(routing.AdminPrefix, "player", username),
+		routing.AdminKey(username),
+		pubsub.Transient,
+		handlerAdmin(s),
+		pubsub.WithVerifier(s.authority.Server()),
+	); err != nil {
+		return fmt.Errorf("failed to subscribe to admin messages: %v", err)
+	}
+
+	if err := pubsub.SubscribeJSON(
+		s.conn,
+		routing.ExchangePerilDirect,
+		routing.QueueName(routing.AdminPrefix, "broadcast", username),
+		routing.AdminBroadcastKey(),
+		pubsub.Transient,
+		handlerAdmin(s),
+		pubsub.WithVerifier(s.authority.Server()),
+	); err != nil {
+		return fmt.Errorf("failed to subscribe to announcements: %v", err)
+	}
+	s.log.Debug("subscribed to admin messages")
+
+	if err := pubsub.SubscribeJSON(
+		s.conn,
+		routing.ExchangePerilDirect,
+		routing.QueueName(routing.PlayerStatePrefix, gameID, username),
+		routing.PlayerStateKey(gameID, username),
+		pubsub.Transient,
+		handlerPlayerState(s.GS),
+		pubsub.WithVerifier(s.authority.Server()),
+	); err != nil {
+		return fmt.Errorf("failed to subscribe to player state: %v", err)
+	}
+	s.log.Debug("subscribed to player state")
+
+	if err := pubsub.SubscribeJSONContext(
+		s.conn,
+		routing.ExchangePerilTopic,
+		routing.QueueName(routing.ArmyMoveViewsPrefix, gameID, username),
+		routing.ArmyMoveViewKey(gameID, username),
+		pubsub.Transient,
+		handlerMove(s),
+		pubsub.WithVerifier(s.authority.Server()),
+	); err != nil {
+		return fmt.Errorf("failed to subscribe to move queue: %v", err)
+	}
+	s.log.Debug("subscribed to army moves")
+
+	if err := pubsub.SubscribeJSONContext(
+		s.conn,
+		routing.ExchangePerilTopic,
+		routing.QueueName(routing.WarRecognitionsPrefix, gameID),
+		routing.WarRecognitionsBinding(gameID),
+		pubsub.Durable,
+		handlerWar(s),
+		pubsub.WithVerifier(s.authority.Players(gameID)),
+	); err != nil {
+		return fmt.Errorf("failed to subscribe to war recognitions queue: %v", err)
+	}
+	s.log.Debug("subscribed to war recognition")
+
+	if err := pubsub.SubscribeJSON(
+		s.conn,
+		routing.ExchangePerilTopic,
+		routing.QueueName(routing.GameOverPrefix, gameID, username),
+		routing.GameOverKey(gameID),
+		pubsub.Transient,
+		handlerGameOver(s.GS),
+		pubsub.WithVerifier(s.authority.Server()),
+	); err != nil {
+		return fmt.Errorf("failed to subscribe to game over: %v", err)
+	}
+	s.log.Debug("subscribed to game over")
+
+	if err := pubsub.SubscribeJSON(
+		s.conn,
+		routing.ExchangePerilTopic,
+		routing.QueueName(routing.RosterPrefix, gameID, username),
+		routing.RosterKey(gameID),
+		pubsub.Transient,
+		handlerRoster(s.GS),
+		pubsub.WithVerifier(s.authority.Server()),
+	); err != nil {
+		return fmt.Errorf("failed to subscribe to roster: %v", err)
+	}
+	s.log.Debug("subscribed to roster")
+
+	if err := pubsub.SubscribeJSON(
+		s.conn,
+		routing.ExchangePerilTopic,
+		routing.QueueName(routing.ChatDeliveryPrefix, gameID, username),
+		routing.ChatBroadcastKey(gameID),
+		pubsub.Transient,
+		handlerChat(s.GS),
+		pubsub.WithVerifier(s.authority.Server()),
+	); err != nil {
+		return fmt.Errorf("failed to subscribe to chat: %v", err)
+	}
+
+	if err := pubsub.SubscribeJSON(
+		s.conn,
+		routing.ExchangePerilTopic,
+		routing.QueueName(routing.ChatDirectPrefix, gameID, username),
+		routing.ChatDirectKey(gameID, username),
+		pubsub.Transient,
+		handlerChat(s.GS),
+		pubsub.WithVerifier(s.authority.Server()),
+	); err != nil {
+		return fmt.Errorf("failed to subscribe to whispers: %v", err)
+	}
+	s.log.Debug("subscribed to chat")
+
+	if err := pubsub.SubscribeJSON(
+		s.conn,
+		routing.ExchangePerilTopic,
+		routing.QueueName(routing.DiplomacyPrefix, gameID, username),
+		routing.DiplomacyBinding(gameID),
+		pubsub.Transient,
+		handlerDiplomacy(s.GS),
+		pubsub.WithVerifier(s.authority.Players(gameID)),
+	); err != nil {
+		return fmt.Errorf("failed to subscribe to diplomacy: %v", err)
+	}
+	s.log.Debug("subscribed to diplomacy")
+
+	return nil
+}
+
+// Start announces the player to the game and starts the heartbeat and
+// income loops.
+func (s *Session) Start() error {
+	if err := s.publishPresence(routing.PresenceJoined); err != nil {
+		return fmt.Errorf("failed to announce presence: %v", err)
+	}
+	go s.sendHeartbeats()
+	return nil
+}
+
+func (s *Session) Leave() error {
+	return s.publishPresence(routing.PresenceLeft)
+}
+
+// Spawn asks the server for a unit and adds it once the server has spawned
+// it.
+func (s *Session) Spawn(words []string) error {
+	spawn, err := s.GS.CommandSpawn(words)
+	if err != nil {
+		return err
+	}
+	result, err := pubsub.RequestJSON[gamelogic.Spawn, gamelogic.SpawnResult](
+		s.conn,
+		routing.ExchangeDefault,
+		routing.SpawnQueue(s.GS.GetGameID()),
+		spawn,
+		spawnTimeout,
+		pubsub.WithRequestSigner(s.signer),
+		pubsub.WithReplyVerifier(s.authority.Server()),
+	)
+	if err != nil {
+		return err
+	}
+	if !result.Accepted {
+		return errors.New(result.Reason)
+	}
+	s.GS.HandleSpawned(result)
+	return nil
+}
+
+func (s *Session) Move(words []string) (gamelogic.ArmyMove, error) {
+	move, err := s.GS.CommandMove(words)
+	if err != nil {
+		return gamelogic.ArmyMove{}, err
+	}
+
+	if err = pubsub.PublishJSON(
+		s.publishCh,
+		routing.ExchangeDefault,
+		routing.ArmyMovesQueue(s.GS.GetGameID()),
+		move,
+		pubsub.WithSigner(s.signer),
+	); err != nil {
+		return gamelogic.ArmyMove{}, err
+	}
+	return move, nil
+}
+
+func (s *Session) Say(words []string) error {
+	msg, err := s.GS.CommandSay(words)
+	if err != nil {
+		return err
+	}
+	return s.publishChat(msg)
+}
+
+func (s *Session) Whisper(words []string) (routing.ChatMessage, error) {
+	msg, err := s.GS.CommandWhisper(words)
+	if err != nil {
+		return routing.ChatMessage{}, err
+	}
+	return msg, s.publishChat(msg)
+}
+
+func (s *Session) Diplomacy(words []string) error {
+	d, err := s.GS.CommandDiplomacy(words)
+	if err != nil {
+		return err
+	}
+	return s.publishDiplomacy(d)
+}
+
+// PublishGameLog publishes a game log, waiting first if the player is over
+// the rate limit.
+func (s *Session) PublishGameLog(log routing.GameLog) error {
+	s.logThrottle.Wait()
+	return s.publishGameLog(context.Background(), log)
+}
@@ -0,0 +1,35 @@
+package gamelogic
+
+import (
+	"fmt"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// HandleAdminMessage shows a message from the server admin. It reports
+// whether the player has been removed from the game, in which case the game
+// is over for them.
+func (gs *GameState) HandleAdminMessage(msg routing.AdminMessage) bool {
+	defer fmt.Println("------------------------")
+	fmt.Println()
+	switch msg.Action {
+	case routing.AdminAnnounce:
+		fmt.Println("==== Announcement ====")
+		fmt.Println(msg.Message)
+		return false
+	case routing.AdminKick, routing.AdminBan:
+		if msg.Action == routing.AdminBan {
+			fmt.Println("==== You Have Been Banned ====")
+		} else {
+			fmt.Println("==== You Have Been Kicked ====")
+		}
+		if msg.Message != "" {
+			fmt.Printf("Reason: %s\n", msg.Message)
+		}
+		gs.endGame()
+		return true
+	default:
+		fmt.Printf("Unknown admin message: %s\n", msg.Action)
+		return false
+	}
+}
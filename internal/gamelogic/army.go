@@ -0,0 +1,82 @@
+package gamelogic
+
+import "fmt"
+
+// Army is the server's record of a player's units. It is built only from the
+// spawns, moves and wars the server has seen, never from what a player
+// reports about themselves.
+type Army struct {
+	Player Player
+	// LastUnit is the highest unit ID issued. IDs are never reused, so a
+	// unit lost in a war can't come back under a new spawn.
+	LastUnit int
+}
+
+func NewArmy(username string) *Army {
+	return &Army{Player: Player{Username: username, Units: map[int]Unit{}, Resources: StartingResources}}
+}
+
+// Spawn pays for a unit of rank and adds it in loc with the next unit ID.
+func (a *Army) Spawn(loc Location, rank UnitRank) (Unit, error) {
+	if _, ok := getAllLocations()[loc]; !ok {
+		return Unit{}, fmt.Errorf("error: %s is not a valid location", loc)
+	}
+	if _, ok := getAllRanks()[rank]; !ok {
+		return Unit{}, fmt.Errorf("error: %s is not a valid unit", rank)
+	}
+	cost := getRankCosts()[rank]
+	if a.Player.Resources < cost {
+		return Unit{}, fmt.Errorf("error: not enough resources, need %d but have %d", cost, a.Player.Resources)
+	}
+	a.Player.Resources -= cost
+	a.LastUnit++
+	unit := Unit{ID: a.LastUnit, Rank: rank, Location: loc}
+	a.Player.Units[unit.ID] = unit
+	return unit, nil
+}
+
+// Move moves the army's units with the IDs of units to loc and returns them
+// as recorded. Units the army doesn't have are ignored.
+func (a *Army) Move(units []Unit, loc Location) []Unit {
+	moved := []Unit{}
+	if _, ok := getAllLocations()[loc]; !ok {
+		return moved
+	}
+	for _, u := range units {
+		unit, ok := a.Player.Units[u.ID]
+		if !ok {
+			continue
+		}
+		unit.Location = loc
+		a.Player.Units[unit.ID] = unit
+		moved = append(moved, unit)
+	}
+	return moved
+}
+
+func (a *Army) RemoveUnits(units []Unit) {
+	for _, unit := range units {
+		delete(a.Player.Units, unit.ID)
+	}
+}
+
+// Fielded reports whether the army has ever had a unit.
+func (a *Army) Fielded() bool {
+	return a.LastUnit > 0
+}
+
+// Eliminated reports whether the army has lost every unit it fielded. A
+// player who hasn't spawned yet is not eliminated, but their treasury can't
+// save them once they have.
+func (a *Army) Eliminated() bool {
+	return a.Fielded() && len(a.Player.Units) == 0
+}
+
+// Snap returns a copy of the player the army belongs to.
+func (a *Army) Snap() Player {
+	units := map[int]Unit{}
+	for id, unit := range a.Player.Units {
+		units[id] = unit
+	}
+	return Player{Username: a.Player.Username, Units: units, Resources: a.Player.Resources}
+}
@@ -0,0 +1,72 @@
+package gamelogic
+
+import (
+	"testing"
+	"time"
+)
+
+func TestArmyMove(t *testing.T) {
+	a := NewArmy("alice")
+	first, err := a.Spawn("europe", RankInfantry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = a.Spawn("atlantis", RankInfantry); err == nil {
+		t.Fatal("spawn in an unknown location accepted")
+	}
+
+	moved := a.Move([]Unit{{ID: first.ID, Rank: RankArtillery}, {ID: 42}}, "asia")
+	if len(moved) != 1 || moved[0].Rank != RankInfantry || moved[0].Location != "asia" {
+		t.Fatalf("Move = %+v, want only the recorded infantry in asia", moved)
+	}
+
+	a.RemoveUnits(moved)
+	second, err := a.Spawn("europe", RankInfantry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.ID == first.ID {
+		t.Fatalf("unit ID %d reused after its unit was lost", first.ID)
+	}
+}
+
+func TestCheckVictoryElimination(t *testing.T) {
+	vc := VictoryConditions{Elimination: true}
+	alice, bob := NewArmy("alice"), NewArmy("bob")
+	if _, err := alice.Spawn("europe", RankInfantry); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := CheckVictory(vc, []*Army{alice, bob}, time.Minute); ok {
+		t.Fatal("game over before bob fielded a unit")
+	}
+
+	unit, err := bob.Spawn("asia", RankInfantry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob.RemoveUnits([]Unit{unit})
+	// resources left unspent don't keep a player in the game
+	bob.Player.Resources = 100
+	gameOver, ok := CheckVictory(vc, []*Army{alice, bob}, time.Minute)
+	if !ok || gameOver.Winner != "alice" {
+		t.Fatalf("CheckVictory = %+v, %v, want alice to win", gameOver, ok)
+	}
+}
+
+func TestArmyTreasury(t *testing.T) {
+	a := NewArmy("alice")
+	if _, err := a.Spawn("europe", RankArtillery); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Spawn("asia", RankArtillery); err == nil {
+		t.Fatal("spawn the army can't pay for accepted")
+	}
+	if got, want := a.Player.Resources, StartingResources-RankCost(RankArtillery); got != want {
+		t.Fatalf("resources = %d, want %d", got, want)
+	}
+
+	if earned := a.CollectIncome(); earned != IncomePerLocation {
+		t.Fatalf("CollectIncome = %d, want %d for one location", earned, IncomePerLocation)
+	}
+}
@@ -0,0 +1,59 @@
+package gamelogic
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+func (gs *GameState) CommandSay(words []string) (routing.ChatMessage, error) {
+	if len(words) < 2 {
+		return routing.ChatMessage{}, errors.New("usage: say <message>")
+	}
+	return routing.ChatMessage{
+		GameID:  gs.GetGameID(),
+		From:    gs.GetUsername(),
+		Message: strings.Join(words[1:], " "),
+		Time:    time.Now(),
+	}, nil
+}
+
+func (gs *GameState) CommandWhisper(words []string) (routing.ChatMessage, error) {
+	if len(words) < 3 {
+		return routing.ChatMessage{}, errors.New("usage: whisper <username> <message>")
+	}
+	if words[1] == gs.GetUsername() {
+		return routing.ChatMessage{}, errors.New("error: you can not whisper to yourself")
+	}
+	return routing.ChatMessage{
+		GameID:  gs.GetGameID(),
+		From:    gs.GetUsername(),
+		To:      words[1],
+		Message: strings.Join(words[2:], " "),
+		Time:    time.Now(),
+	}, nil
+}
+
+// HandleChat prints a relayed chat message and reports whether anything was
+// shown.
+func (gs *GameState) HandleChat(msg routing.ChatMessage) bool {
+	if msg.From == gs.GetUsername() && !msg.History {
+		return false
+	}
+
+	fmt.Println()
+	prefix := ""
+	if msg.History {
+		prefix = "(earlier) "
+	}
+	stamp := msg.Time.Format("15:04")
+	if msg.To != "" {
+		fmt.Printf("%s[%s] %s whispers: %s\n", prefix, stamp, msg.From, msg.Message)
+	} else {
+		fmt.Printf("%s[%s] %s: %s\n", prefix, stamp, msg.From, msg.Message)
+	}
+	return true
+}
@@ -0,0 +1,273 @@
+package gamelogic
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// Terrain modifies combat in a location. Bonuses are percentages added to a
+// unit's base power.
+type Terrain struct {
+	Name         string
+	DefenseBonus int
+	RankBonus    map[UnitRank]int
+}
+
+func getAllTerrain() map[Location]Terrain {
+	return map[Location]Terrain{
+		"americas":   {Name: "plains", RankBonus: map[UnitRank]int{RankCavalry: 25}},
+		"europe":     {Name: "cities", DefenseBonus: 10, RankBonus: map[UnitRank]int{RankInfantry: 25}},
+		"africa":     {Name: "desert", RankBonus: map[UnitRank]int{RankCavalry: 10, RankArtillery: -10}},
+		"asia":       {Name: "mountains", DefenseBonus: 20, RankBonus: map[UnitRank]int{RankInfantry: 25, RankArtillery: -25}},
+		"australia":  {Name: "outback"},
+		"antarctica": {Name: "ice", RankBonus: map[UnitRank]int{RankInfantry: -25, RankCavalry: -25, RankArtillery: -25}},
+	}
+}
+
+// counterBonus is the percentage bonus a rank gets when the enemy fields the
+// rank it counters.
+const counterBonus = 50
+
+func getRankCounters() map[UnitRank]UnitRank {
+	return map[UnitRank]UnitRank{
+		RankCavalry:   RankArtillery,
+		RankArtillery: RankInfantry,
+		RankInfantry:  RankCavalry,
+	}
+}
+
+func getRankPower() map[UnitRank]int {
+	return map[UnitRank]int{
+		RankInfantry:  1,
+		RankCavalry:   5,
+		RankArtillery: 10,
+	}
+}
+
+// BattleReport describes a battle. Powers and scores are in hundredths, so
+// terrain and counter bonuses of a few percent aren't lost to rounding.
+type BattleReport struct {
+	Location          Location
+	Terrain           string
+	Seed              int64
+	Attacker          string
+	Defender          string
+	AttackerPower     int
+	DefenderPower     int
+	AttackerRoll      int
+	DefenderRoll      int
+	AttackerScore     int
+	DefenderScore     int
+	AttackerLosses    []Unit
+	DefenderLosses    []Unit
+	AttackerSurvivors []Unit
+	DefenderSurvivors []Unit
+	// Winner and Loser are empty when the battle is a draw.
+	Winner string
+	Loser  string
+}
+
+func (r BattleReport) IsDraw() bool {
+	return r.Winner == ""
+}
+
+// LossesOf returns the units username lost in the battle.
+func (r BattleReport) LossesOf(username string) []Unit {
+	switch username {
+	case r.Attacker:
+		return r.AttackerLosses
+	case r.Defender:
+		return r.DefenderLosses
+	}
+	return nil
+}
+
+func unitsAt(p Player, loc Location) []Unit {
+	units := []Unit{}
+	for _, unit := range p.Units {
+		if unit.Location == loc {
+			units = append(units, unit)
+		}
+	}
+	// map order is random, sort so every client rolls the same dice
+	sort.Slice(units, func(i, j int) bool {
+		return units[i].ID < units[j].ID
+	})
+	return units
+}
+
+// PowerAt is the base power of the player's units in loc, ignoring terrain
+// and counters.
+func PowerAt(p Player, loc Location) int {
+	return unitsToPowerLevel(unitsAt(p, loc))
+}
+
+// sidePower is the power of units against enemy in hundredths. A bonus can
+// never take a unit below zero.
+func sidePower(units, enemy []Unit, terrain Terrain, defending bool) int {
+	enemyRanks := map[UnitRank]struct{}{}
+	for _, unit := range enemy {
+		enemyRanks[unit.Rank] = struct{}{}
+	}
+
+	power := 0
+	for _, unit := range units {
+		bonus := terrain.RankBonus[unit.Rank]
+		if defending {
+			bonus += terrain.DefenseBonus
+		}
+		if _, ok := enemyRanks[getRankCounters()[unit.Rank]]; ok {
+			bonus += counterBonus
+		}
+		power += getRankPower()[unit.Rank] * max(100+bonus, 0)
+	}
+	return power
+}
+
+// rollCasualties kills each unit with the given percent chance.
+func rollCasualties(rng *rand.Rand, units []Unit, chance int) (losses, survivors []Unit) {
+	losses, survivors = []Unit{}, []Unit{}
+	for _, unit := range units {
+		if rng.Intn(100) < chance {
+			losses = append(losses, unit)
+		} else {
+			survivors = append(survivors, unit)
+		}
+	}
+	return losses, survivors
+}
+
+// ResolveBattle fights a battle between the attacker's and defender's units in
+// loc. The same seed always produces the same report, so every client can
+// resolve a war independently.
+func ResolveBattle(attacker, defender Player, loc Location, seed int64) BattleReport {
+	rng := rand.New(rand.NewSource(seed))
+	terrain := getAllTerrain()[loc]
+	attackerUnits := unitsAt(attacker, loc)
+	defenderUnits := unitsAt(defender, loc)
+
+	r := BattleReport{
+		Location:      loc,
+		Terrain:       terrain.Name,
+		Seed:          seed,
+		Attacker:      attacker.Username,
+		Defender:      defender.Username,
+		AttackerPower: sidePower(attackerUnits, defenderUnits, terrain, false),
+		DefenderPower: sidePower(defenderUnits, attackerUnits, terrain, true),
+		AttackerRoll:  rng.Intn(6) + 1,
+		DefenderRoll:  rng.Intn(6) + 1,
+	}
+	// each pip on the die is worth 10% of the side's power, from 60% to 110%
+	r.AttackerScore = battleScore(r.AttackerPower, r.AttackerRoll)
+	r.DefenderScore = battleScore(r.DefenderPower, r.DefenderRoll)
+
+	total := r.AttackerScore + r.DefenderScore
+	switch {
+	case r.AttackerScore > r.DefenderScore:
+		r.Winner, r.Loser = r.Attacker, r.Defender
+		margin := r.AttackerScore * 100 / total
+		r.AttackerLosses, r.AttackerSurvivors = rollCasualties(rng, attackerUnits, (100-margin)/2)
+		r.DefenderLosses, r.DefenderSurvivors = rollCasualties(rng, defenderUnits, margin)
+	case r.DefenderScore > r.AttackerScore:
+		r.Winner, r.Loser = r.Defender, r.Attacker
+		margin := r.DefenderScore * 100 / total
+		r.AttackerLosses, r.AttackerSurvivors = rollCasualties(rng, attackerUnits, margin)
+		r.DefenderLosses, r.DefenderSurvivors = rollCasualties(rng, defenderUnits, (100-margin)/2)
+	default:
+		r.AttackerLosses, r.AttackerSurvivors = rollCasualties(rng, attackerUnits, 50)
+		r.DefenderLosses, r.DefenderSurvivors = rollCasualties(rng, defenderUnits, 50)
+	}
+	return r
+}
+
+// battleScore scales power, in hundredths, by a roll of the die.
+func battleScore(power, roll int) int {
+	return power * (50 + roll*10) / 100
+}
+
+// hundredths formats a power or score for display.
+func hundredths(n int) string {
+	return fmt.Sprintf("%d.%02d", n/100, n%100)
+}
+
+func PrintBattleReport(r BattleReport) {
+	fmt.Printf("Battle for %s (%s):\n", r.Location, r.Terrain)
+	fmt.Printf("  %s: power %s, rolled %d, score %s\n", r.Attacker, hundredths(r.AttackerPower), r.AttackerRoll, hundredths(r.AttackerScore))
+	fmt.Printf("  %s: power %s, rolled %d, score %s\n", r.Defender, hundredths(r.DefenderPower), r.DefenderRoll, hundredths(r.DefenderScore))
+	if r.IsDraw() {
+		fmt.Println("  The battle ended in a draw!")
+	} else {
+		fmt.Printf("  %s won the battle!\n", r.Winner)
+	}
+	fmt.Printf("  %s lost %d unit(s), %d survived\n", r.Attacker, len(r.AttackerLosses), len(r.AttackerSurvivors))
+	fmt.Printf("  %s lost %d unit(s), %d survived\n", r.Defender, len(r.DefenderLosses), len(r.DefenderSurvivors))
+}
+
+// Summary describes the battle for the game log.
+func (r BattleReport) Summary() string {
+	if r.IsDraw() {
+		return fmt.Sprintf("A battle between %s and %s in %s resulted in a draw (%d vs %d losses)", r.Attacker, r.Defender, r.Location, len(r.AttackerLosses), len(r.DefenderLosses))
+	}
+	return fmt.Sprintf("%s won a battle against %s in %s (%d vs %d losses)", r.Winner, r.Loser, r.Location, len(r.LossesOf(r.Winner)), len(r.LossesOf(r.Loser)))
+}
+
+// WarReport collects the battles fought in every contested location of a
+// war.
+type WarReport struct {
+	Attacker string
+	Defender string
+	// Seed is the war's seed, which reproduces every battle from the same
+	// armies.
+	Seed    int64
+	Battles []BattleReport
+}
+
+func (w WarReport) LossesOf(username string) []Unit {
+	losses := []Unit{}
+	for _, b := range w.Battles {
+		losses = append(losses, b.LossesOf(username)...)
+	}
+	return losses
+}
+
+func (w WarReport) tally() (attackerWins, defenderWins, draws int) {
+	for _, b := range w.Battles {
+		switch b.Winner {
+		case w.Attacker:
+			attackerWins++
+		case w.Defender:
+			defenderWins++
+		default:
+			draws++
+		}
+	}
+	return attackerWins, defenderWins, draws
+}
+
+// Winner is the player who won the most battles, or empty for a draw.
+func (w WarReport) Winner() string {
+	attackerWins, defenderWins, _ := w.tally()
+	switch {
+	case attackerWins > defenderWins:
+		return w.Attacker
+	case defenderWins > attackerWins:
+		return w.Defender
+	}
+	return ""
+}
+
+// Summary describes the whole war for the game log.
+func (w WarReport) Summary() string {
+	if len(w.Battles) == 1 {
+		return w.Battles[0].Summary()
+	}
+	attackerWins, defenderWins, draws := w.tally()
+	battles := []string{}
+	for _, b := range w.Battles {
+		battles = append(battles, b.Summary())
+	}
+	return fmt.Sprintf("%s and %s fought %d battles (%s won %d, %s won %d, %d drawn): %s",
+		w.Attacker, w.Defender, len(w.Battles), w.Attacker, attackerWins, w.Defender, defenderWins, draws, strings.Join(battles, "; "))
+}
@@ -0,0 +1,112 @@
+package gamelogic
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testPlayer(username string, units ...Unit) Player {
+	p := Player{Username: username, Units: map[int]Unit{}}
+	for _, unit := range units {
+		p.Units[unit.ID] = unit
+	}
+	return p
+}
+
+func TestResolveBattle(t *testing.T) {
+	tests := []struct {
+		name           string
+		attacker       Player
+		defender       Player
+		loc            Location
+		seed           int64
+		attackerPower  int
+		defenderPower  int
+		attackerScore  int
+		defenderScore  int
+		winner         string
+		attackerLosses int
+		defenderLosses int
+	}{
+		{
+			name:          "terrain penalty keeps a fraction of power",
+			attacker:      testPlayer("attacker", Unit{ID: 1, Rank: RankInfantry, Location: "antarctica"}),
+			defender:      testPlayer("defender", Unit{ID: 1, Rank: RankInfantry, Location: "antarctica"}),
+			loc:           "antarctica",
+			seed:          1,
+			attackerPower: 75,
+			defenderPower: 75,
+			attackerScore: 82,
+			defenderScore: 67,
+			winner:        "attacker",
+		},
+		{
+			name: "counters and terrain bonuses",
+			attacker: testPlayer("attacker",
+				Unit{ID: 1, Rank: RankCavalry, Location: "americas"},
+				Unit{ID: 2, Rank: RankInfantry, Location: "americas"},
+			),
+			defender:       testPlayer("defender", Unit{ID: 1, Rank: RankArtillery, Location: "americas"}),
+			loc:            "americas",
+			seed:           7,
+			attackerPower:  975,
+			defenderPower:  1500,
+			attackerScore:  780,
+			defenderScore:  900,
+			winner:         "defender",
+			defenderLosses: 1,
+		},
+		{
+			name:     "defense bonus",
+			attacker: testPlayer("attacker", Unit{ID: 1, Rank: RankArtillery, Location: "asia"}),
+			defender: testPlayer("defender",
+				Unit{ID: 1, Rank: RankInfantry, Location: "asia"},
+				Unit{ID: 2, Rank: RankInfantry, Location: "asia"},
+			),
+			loc:            "asia",
+			seed:           42,
+			attackerPower:  1250,
+			defenderPower:  290,
+			attackerScore:  1375,
+			defenderScore:  319,
+			winner:         "attacker",
+			defenderLosses: 2,
+		},
+		{
+			name:          "units elsewhere don't fight",
+			attacker:      testPlayer("attacker", Unit{ID: 1, Rank: RankInfantry, Location: "australia"}, Unit{ID: 2, Rank: RankArtillery, Location: "asia"}),
+			defender:      testPlayer("defender", Unit{ID: 1, Rank: RankInfantry, Location: "australia"}),
+			loc:           "australia",
+			seed:          3,
+			attackerPower: 100,
+			defenderPower: 100,
+			attackerScore: 100,
+			defenderScore: 110,
+			winner:        "defender",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := ResolveBattle(tt.attacker, tt.defender, tt.loc, tt.seed)
+			if r.AttackerPower != tt.attackerPower || r.DefenderPower != tt.defenderPower {
+				t.Errorf("power = %d vs %d, want %d vs %d", r.AttackerPower, r.DefenderPower, tt.attackerPower, tt.defenderPower)
+			}
+			if r.AttackerScore != tt.attackerScore || r.DefenderScore != tt.defenderScore {
+				t.Errorf("score = %d vs %d, want %d vs %d", r.AttackerScore, r.DefenderScore, tt.attackerScore, tt.defenderScore)
+			}
+			if r.Winner != tt.winner {
+				t.Errorf("winner = %q, want %q", r.Winner, tt.winner)
+			}
+			if len(r.AttackerLosses) != tt.attackerLosses || len(r.DefenderLosses) != tt.defenderLosses {
+				t.Errorf("losses = %d vs %d, want %d vs %d", len(r.AttackerLosses), len(r.DefenderLosses), tt.attackerLosses, tt.defenderLosses)
+			}
+			if got := len(r.AttackerLosses) + len(r.AttackerSurvivors); got != len(unitsAt(tt.attacker, tt.loc)) {
+				t.Errorf("attacker has %d units after the battle, want %d", got, len(unitsAt(tt.attacker, tt.loc)))
+			}
+			if again := ResolveBattle(tt.attacker, tt.defender, tt.loc, tt.seed); !reflect.DeepEqual(r, again) {
+				t.Errorf("same seed resolved differently:\n%+v\n%+v", r, again)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package gamelogic
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// logDeduper remembers the IDs of game logs written within the window so
+// redelivered copies can be dropped. It is not safe for concurrent use; the
+// LogWriter guards it with its own mutex.
+type logDeduper struct {
+	window time.Duration
+	seen   map[string]time.Time
+}
+
+func newLogDeduper(window time.Duration) *logDeduper {
+	return &logDeduper{
+		window: window,
+		seen:   map[string]time.Time{},
+	}
+}
+
+func (d *logDeduper) enabled() bool {
+	return d.window > 0
+}
+
+func (d *logDeduper) mark(id string, at time.Time) {
+	if id == "" {
+		return
+	}
+	if prev, ok := d.seen[id]; ok && prev.After(at) {
+		return
+	}
+	d.seen[id] = at
+}
+
+func (d *logDeduper) isDuplicate(id string) bool {
+	if id == "" {
+		return false
+	}
+	_, ok := d.seen[id]
+	return ok
+}
+
+func (d *logDeduper) prune(now time.Time) {
+	for id, at := range d.seen {
+		if now.Sub(at) > d.window {
+			delete(d.seen, id)
+		}
+	}
+}
+
+// filter returns the game logs that have not been written yet, dropping
+// duplicates within the batch as well.
+func (d *logDeduper) filter(gamelogs []routing.GameLog) []routing.GameLog {
+	if !d.enabled() {
+		return gamelogs
+	}
+	fresh := []routing.GameLog{}
+	batch := map[string]bool{}
+	for _, gamelog := range gamelogs {
+		if d.isDuplicate(gamelog.ID) || (gamelog.ID != "" && batch[gamelog.ID]) {
+			slog.Debug("dropped duplicate game log", "message_id", gamelog.ID, "username", gamelog.Username, "game", gamelog.GameID)
+			continue
+		}
+		batch[gamelog.ID] = true
+		fresh = append(fresh, gamelog)
+	}
+	return fresh
+}
+
+// load remembers the IDs found in r. Records are timestamped with the time
+// they were written so the window survives restarts.
+func (d *logDeduper) load(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var rec LogRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			continue
+		}
+		at := rec.WrittenAt
+		if at.IsZero() {
+			at = rec.Time
+		}
+		if time.Since(at) <= d.window {
+			d.mark(rec.ID, at)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("could not read logs file: %v", err)
+	}
+	return nil
+}
+
+// loadFiles seeds the deduper from the rotated logs files. The LogWriter
+// reads the current one as it catches up.
+func (d *logDeduper) loadFiles() error {
+	if !d.enabled() {
+		return nil
+	}
+	files, err := rotatedLogs()
+	if err != nil {
+		return fmt.Errorf("could not list rotated logs: %v", err)
+	}
+	for _, path := range files {
+		if t, ok := rotatedAt(path); ok && time.Since(t) > d.window {
+			continue
+		}
+		if err := readLogsFile(path, d.load); err != nil {
+			return err
+		}
+	}
+	return nil
+}
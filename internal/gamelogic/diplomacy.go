@@ -0,0 +1,164 @@
+package gamelogic
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// TruceDuration is how long a truce holds before the players are free to go
+// to war again. Alliances last until one side breaks them.
+const TruceDuration = 5 * time.Minute
+
+type pact struct {
+	kind    Pact
+	expires time.Time
+}
+
+func (p pact) active(now time.Time) bool {
+	return p.expires.IsZero() || now.Before(p.expires)
+}
+
+func newPact(kind Pact) pact {
+	p := pact{kind: kind}
+	if kind == PactTruce {
+		p.expires = time.Now().Add(TruceDuration)
+	}
+	return p
+}
+
+func (gs *GameState) IsAlliedWith(username string) bool {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	p, ok := gs.pacts[username]
+	return ok && p.active(time.Now())
+}
+
+// CommandDiplomacy handles the ally, truce, accept and break commands and
+// returns the message to send to the other player.
+func (gs *GameState) CommandDiplomacy(words []string) (Diplomacy, error) {
+	if len(words) < 2 {
+		return Diplomacy{}, fmt.Errorf("usage: %s <username>", words[0])
+	}
+	other := words[1]
+	if other == gs.GetUsername() {
+		return Diplomacy{}, errors.New("error: you can not make a pact with yourself")
+	}
+
+	d := Diplomacy{From: gs.GetUsername(), To: other}
+
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	switch words[0] {
+	case "ally", "truce":
+		kind := PactAlliance
+		if words[0] == "truce" {
+			kind = PactTruce
+		}
+		if p, ok := gs.pacts[other]; ok && p.active(time.Now()) {
+			return Diplomacy{}, fmt.Errorf("error: you already have a %s with %s", p.kind, other)
+		}
+		gs.proposals[other] = kind
+		d.Action = DiplomacyPropose
+		d.Pact = kind
+		fmt.Printf("Proposed a %s to %s\n", kind, other)
+	case "accept":
+		kind, ok := gs.offers[other]
+		if !ok {
+			return Diplomacy{}, fmt.Errorf("error: %s has not proposed a pact", other)
+		}
+		delete(gs.offers, other)
+		gs.pacts[other] = newPact(kind)
+		d.Action = DiplomacyAccept
+		d.Pact = kind
+		fmt.Printf("You are now in a %s with %s\n", kind, other)
+	case "break":
+		p, ok := gs.pacts[other]
+		if !ok {
+			return Diplomacy{}, fmt.Errorf("error: you have no pact with %s", other)
+		}
+		delete(gs.pacts, other)
+		d.Action = DiplomacyBreak
+		d.Pact = p.kind
+		fmt.Printf("You broke your %s with %s\n", p.kind, other)
+	default:
+		return Diplomacy{}, fmt.Errorf("error: unknown diplomacy command %s", words[0])
+	}
+	return d, nil
+}
+
+// HandleDiplomacy applies a message from another player and reports whether
+// it was addressed to us.
+func (gs *GameState) HandleDiplomacy(d Diplomacy) bool {
+	if d.To != gs.GetUsername() {
+		return false
+	}
+
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	fmt.Println()
+	switch d.Action {
+	case DiplomacyPropose:
+		gs.offers[d.From] = d.Pact
+		fmt.Printf("%s proposes a %s. Type \"accept %s\" to agree.\n", d.From, d.Pact, d.From)
+	case DiplomacyAccept:
+		kind, ok := gs.proposals[d.From]
+		if !ok || kind != d.Pact {
+			fmt.Printf("%s accepted a %s you did not propose.\n", d.From, d.Pact)
+			return true
+		}
+		delete(gs.proposals, d.From)
+		gs.pacts[d.From] = newPact(d.Pact)
+		fmt.Printf("%s accepted your %s!\n", d.From, d.Pact)
+	case DiplomacyBreak:
+		delete(gs.pacts, d.From)
+		delete(gs.proposals, d.From)
+		fmt.Printf("%s has broken your %s!\n", d.From, d.Pact)
+	default:
+		fmt.Printf("Unknown diplomacy action from %s: %s\n", d.From, d.Action)
+	}
+	return true
+}
+
+// DiplomacyLogMessage describes a pact being formed or broken for the game
+// log. It returns false for messages that should not be logged.
+func DiplomacyLogMessage(d Diplomacy) (string, bool) {
+	switch d.Action {
+	case DiplomacyAccept:
+		return fmt.Sprintf("%s and %s formed a %s", d.From, d.To, d.Pact), true
+	case DiplomacyBreak:
+		return fmt.Sprintf("%s broke their %s with %s", d.From, d.Pact, d.To), true
+	}
+	return "", false
+}
+
+func (gs *GameState) printPacts() {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+
+	now := time.Now()
+	names := []string{}
+	for username, p := range gs.pacts {
+		if p.active(now) {
+			names = append(names, username)
+		}
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		fmt.Println("You have no alliances or truces.")
+	}
+	for _, username := range names {
+		p := gs.pacts[username]
+		if p.kind == PactTruce {
+			fmt.Printf("* truce with %s (%v left)\n", username, p.expires.Sub(now).Round(time.Second))
+			continue
+		}
+		fmt.Printf("* alliance with %s\n", username)
+	}
+	for username, kind := range gs.offers {
+		fmt.Printf("* %s has proposed a %s\n", username, kind)
+	}
+}
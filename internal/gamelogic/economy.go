@@ -0,0 +1,41 @@
+package gamelogic
+
+import "time"
+
+const (
+	StartingResources = 10
+	IncomePerLocation = 2
+	IncomeInterval    = 30 * time.Second
+)
+
+func getRankCosts() map[UnitRank]int {
+	return map[UnitRank]int{
+		RankInfantry:  1,
+		RankCavalry:   4,
+		RankArtillery: 8,
+	}
+}
+
+func RankCost(rank UnitRank) int {
+	return getRankCosts()[rank]
+}
+
+func heldLocations(p Player) map[Location]struct{} {
+	held := map[Location]struct{}{}
+	for _, unit := range p.Units {
+		held[unit.Location] = struct{}{}
+	}
+	return held
+}
+
+func incomeFor(p Player) int {
+	return len(heldLocations(p)) * IncomePerLocation
+}
+
+// CollectIncome pays the army one tick of income for every location it
+// holds and returns what it earned.
+func (a *Army) CollectIncome() int {
+	earned := incomeFor(a.Player)
+	a.Player.Resources += earned
+	return earned
+}
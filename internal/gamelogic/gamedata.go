@@ -1,8 +1,16 @@
 package gamelogic
 
+import "sort"
+
 type Player struct {
-	Username string
-	Units    map[int]Unit
+	Username  string
+	Units     map[int]Unit
+	Resources int
+}
+
+// ClaimedBy lets signed player states be checked against their signer.
+func (p Player) ClaimedBy() string {
+	return p.Username
 }
 
 type UnitRank string
@@ -25,9 +33,66 @@ type ArmyMove struct {
 	ToLocation Location
 }
 
+func (move ArmyMove) ClaimedBy() string {
+	return move.Player.Username
+}
+
+// Spawn asks the server for a new unit. The server picks its ID.
+type Spawn struct {
+	Username string
+	Location Location
+	Rank     UnitRank
+}
+
+func (s Spawn) ClaimedBy() string {
+	return s.Username
+}
+
+type SpawnResult struct {
+	Accepted bool
+	Reason   string
+	Unit     Unit
+	// Resources is the spawner's treasury after paying for the unit.
+	Resources int
+}
+
 type RecognitionOfWar struct {
 	Attacker Player
 	Defender Player
+	// Locations are the contested locations, each fought as its own battle.
+	Locations []Location
+	Seed      int64
+}
+
+// ClaimedBy is the defender, who recognizes the war.
+func (rw RecognitionOfWar) ClaimedBy() string {
+	return rw.Defender.Username
+}
+
+type Pact string
+
+const (
+	PactAlliance Pact = "alliance"
+	PactTruce    Pact = "truce"
+)
+
+type DiplomacyAction string
+
+const (
+	DiplomacyPropose DiplomacyAction = "propose"
+	DiplomacyAccept  DiplomacyAction = "accept"
+	DiplomacyBreak   DiplomacyAction = "break"
+)
+
+type Diplomacy struct {
+	From   string
+	To     string
+	Action DiplomacyAction
+	Pact   Pact
+}
+
+func (d Diplomacy) ClaimedBy() string {
+	return d.From
 }
 
 type Location string
@@ -50,3 +115,20 @@ func getAllLocations() map[Location]struct{} {
 		"antarctica": {},
 	}
 }
+
+// AllLocations lists every location in a stable order.
+func AllLocations() []Location {
+	locs := []Location{}
+	for loc := range getAllLocations() {
+		locs = append(locs, loc)
+	}
+	sort.Slice(locs, func(i, j int) bool {
+		return locs[i] < locs[j]
+	})
+	return locs
+}
+
+// AllRanks lists every rank from cheapest to most expensive.
+func AllRanks() []UnitRank {
+	return []UnitRank{RankInfantry, RankCavalry, RankArtillery}
+}
@@ -0,0 +1,22 @@
+package gamelogic
+
+import (
+	"fmt"
+	"regexp"
+)
+
+const maxGameIDLength = 20
+
+var gameIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// ValidateGameID checks a game ID is safe to use in queue names and routing
+// keys, where a . would add a word and * or # would match other games.
+func ValidateGameID(id string) error {
+	switch {
+	case id == "" || len(id) > maxGameIDLength:
+		return fmt.Errorf("error: game ID must be 1 to %d characters long", maxGameIDLength)
+	case !gameIDPattern.MatchString(id):
+		return fmt.Errorf("error: game ID must start with a letter or digit and contain only letters, digits, - and _")
+	}
+	return nil
+}
@@ -7,6 +7,9 @@ import (
 	"math/rand"
 	"os"
 	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
 )
 
 func PrintClientHelp() {
@@ -17,7 +20,18 @@ func PrintClientHelp() {
 	fmt.Println("* spawn <location> <rank>")
 	fmt.Println("    example:")
 	fmt.Println("    spawn europe infantry")
+	fmt.Println("    costs: infantry 1, cavalry 4, artillery 8")
 	fmt.Println("* status")
+	fmt.Println("* say <message>")
+	fmt.Println("    example:")
+	fmt.Println("    say hello everyone")
+	fmt.Println("* whisper <username> <message>")
+	fmt.Println("    example:")
+	fmt.Println("    whisper bob meet me in asia")
+	fmt.Println("* ally <username>")
+	fmt.Println("* truce <username>")
+	fmt.Println("* accept <username>")
+	fmt.Println("* break <username>")
 	fmt.Println("* spam <n>")
 	fmt.Println("    example:")
 	fmt.Println("    spam 5")
@@ -25,27 +39,106 @@ func PrintClientHelp() {
 	fmt.Println("* help")
 }
 
-func ClientWelcome() (string, error) {
+func ClientWelcome() (string, string, error) {
 	fmt.Println("Welcome to the Peril client!")
-	fmt.Println("Please enter your username:")
-	words := GetInput()
-	if len(words) == 0 {
-		return "", errors.New("you must enter a username. goodbye")
+	return PromptCredentials()
+}
+
+// PromptCredentials asks for a username until a valid one is entered, then
+// for an optional password.
+func PromptCredentials() (string, string, error) {
+	for {
+		fmt.Println("Please enter your username:")
+		words := GetInput()
+		if len(words) == 0 {
+			return "", "", errors.New("you must enter a username. goodbye")
+		}
+		username := words[0]
+		if err := ValidateUsername(username); err != nil {
+			fmt.Println(err)
+			continue
+		}
+
+		fmt.Println("Enter a password to reserve this name, or press enter to skip:")
+		return username, GetPassword(), nil
+	}
+}
+
+func PrintLobbyHelp() {
+	fmt.Println("Lobby commands:")
+	fmt.Println("* games")
+	fmt.Println("* join <gameID>")
+	fmt.Println("    example:")
+	fmt.Println("    join default")
+	fmt.Println("* quit")
+	fmt.Println("* help")
+}
+
+func PrintLobby(lobby routing.Lobby) {
+	if len(lobby.Games) == 0 {
+		fmt.Println("There are no open games.")
+		return
+	}
+	fmt.Println("Open games:")
+	for _, g := range lobby.Games {
+		state := "running"
+		if g.Over {
+			state = "over"
+		} else if g.Paused {
+			state = "paused"
+		}
+		fmt.Printf("* %s (%s, %d players: %s) victory: %s\n", g.ID, state, len(g.Players), strings.Join(g.Players, ", "), g.Victory)
+	}
+}
+
+func PrintRoster(gameID string, roster []routing.RosterEntry) {
+	fmt.Printf("Players in %s:\n", gameID)
+	if len(roster) == 0 {
+		fmt.Println("  (none)")
+		return
+	}
+	for _, entry := range roster {
+		state := "connected"
+		if !entry.Connected {
+			state = "disconnected"
+		}
+		fmt.Printf("* %s (%s, last seen %v ago)\n", entry.Username, state, time.Since(entry.LastSeen).Round(time.Second))
 	}
-	username := words[0]
-	fmt.Printf("Welcome, %s!\n", username)
-	PrintClientHelp()
-	return username, nil
 }
 
 func PrintServerHelp() {
 	fmt.Println("Possible commands:")
-	fmt.Println("* pause")
-	fmt.Println("* resume")
+	fmt.Println("* create <gameID>")
+	fmt.Println("* games")
+	fmt.Println("* pause <gameID> [at <time>] [duration] [reason]")
+	fmt.Println("    example:")
+	fmt.Println("    pause europe 10m maintenance")
+	fmt.Println("    pause europe at 18:30 15m dinner break")
+	fmt.Println("* resume <gameID>")
+	fmt.Println("* standings <gameID>")
+	fmt.Println("* players [gameID]")
+	fmt.Println("* kick <username> [reason]")
+	fmt.Println("* ban <username> [reason]")
+	fmt.Println("* unban <username>")
+	fmt.Println("* bans")
+	fmt.Println("* announce <message>")
+	fmt.Println("    example:")
+	fmt.Println("    announce server restarting in 5 minutes")
+	fmt.Println("* logs [user=<username>] [game=<gameID>] [event=<type>] [since=<time>] [until=<time>] [search=<text>] [page=<n>]")
+	fmt.Println("    example:")
+	fmt.Println("    logs user=bob since=1h search=asia")
+	fmt.Println("* import <path>")
+	fmt.Println("    example:")
+	fmt.Println("    import game.log")
+	fmt.Println("* offenders")
+	fmt.Println("* dlq [limit]")
+	fmt.Println("* moderation [reload]")
 	fmt.Println("* quit")
 	fmt.Println("* help")
 }
 
+// GetInput prompts for a line and splits it into words. It returns nil once
+// stdin is closed, and an empty slice for a blank line.
 func GetInput() []string {
 	fmt.Print("> ")
 	scanner := bufio.NewScanner(os.Stdin)
@@ -77,16 +170,26 @@ func PrintQuit() {
 }
 
 func (gs *GameState) CommandStatus() {
-	if gs.isPaused() {
+	if gs.IsOver() {
+		fmt.Println("The game is over.")
+	}
+	if gs.IsPaused() {
 		fmt.Println("The game is paused.")
+		printPause(gs.getPause(), time.Now())
 		return
 	} else {
 		fmt.Println("The game is not paused.")
+		if ps := gs.getPause(); ps.IsScheduled() {
+			printPause(ps, time.Now())
+		}
 	}
 
 	p := gs.GetPlayerSnap()
+	fmt.Printf("You are playing game %s.\n", gs.GetGameID())
 	fmt.Printf("You are %s, and you have %d units.\n", p.Username, len(p.Units))
+	fmt.Printf("Treasury: %d resources (+%d every %v)\n", p.Resources, incomeFor(p), IncomeInterval)
 	for _, unit := range p.Units {
 		fmt.Printf("* %v: %v, %v\n", unit.ID, unit.Location, unit.Rank)
 	}
+	gs.printPacts()
 }
@@ -1,23 +1,37 @@
 package gamelogic
 
 import (
+	"fmt"
 	"sync"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
 )
 
 type GameState struct {
-	Player Player
-	Paused bool
-	mu     *sync.RWMutex
+	GameID    string
+	Player    Player
+	Paused    bool
+	Over      bool
+	pause     routing.PlayingState
+	pacts     map[string]pact
+	offers    map[string]Pact // proposals received, keyed by proposer
+	proposals map[string]Pact // proposals sent, keyed by recipient
+	mu        *sync.RWMutex
 }
 
-func NewGameState(username string) *GameState {
+func NewGameState(gameID, username string) *GameState {
 	return &GameState{
+		GameID: gameID,
 		Player: Player{
-			Username: username,
-			Units:    map[int]Unit{},
+			Username:  username,
+			Units:     map[int]Unit{},
+			Resources: StartingResources,
 		},
-		Paused: false,
-		mu:     &sync.RWMutex{},
+		Paused:    false,
+		pacts:     map[string]pact{},
+		offers:    map[string]Pact{},
+		proposals: map[string]Pact{},
+		mu:        &sync.RWMutex{},
 	}
 }
 
@@ -25,36 +39,82 @@ func (gs *GameState) resumeGame() {
 	gs.mu.Lock()
 	defer gs.mu.Unlock()
 	gs.Paused = false
+	gs.pause = routing.PlayingState{}
 }
 
-func (gs *GameState) pauseGame() {
+// pauseGame records ps, which is either the current pause or one scheduled
+// for later.
+func (gs *GameState) pauseGame(ps routing.PlayingState) {
 	gs.mu.Lock()
 	defer gs.mu.Unlock()
-	gs.Paused = true
+	gs.Paused = ps.IsPaused
+	gs.pause = ps
 }
 
-func (gs *GameState) isPaused() bool {
+func (gs *GameState) getPause() routing.PlayingState {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	return gs.pause
+}
+
+func (gs *GameState) IsPaused() bool {
 	gs.mu.RLock()
 	defer gs.mu.RUnlock()
 	return gs.Paused
 }
 
+func (gs *GameState) endGame() {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	gs.Over = true
+}
+
+func (gs *GameState) IsOver() bool {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	return gs.Over
+}
+
 func (gs *GameState) addUnit(u Unit) {
 	gs.mu.Lock()
 	defer gs.mu.Unlock()
 	gs.Player.Units[u.ID] = u
 }
 
-func (gs *GameState) removeUnitsInLocation(loc Location) {
+func (gs *GameState) removeUnits(units []Unit) {
 	gs.mu.Lock()
 	defer gs.mu.Unlock()
-	for k, v := range gs.Player.Units {
-		if v.Location == loc {
-			delete(gs.Player.Units, k)
-		}
+	for _, u := range units {
+		delete(gs.Player.Units, u.ID)
 	}
 }
 
+func (gs *GameState) setResources(resources int) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	gs.Player.Resources = resources
+}
+
+// HandlePlayerState replaces our units and treasury with the server's record
+// of them, which wins over anything we worked out ourselves. It returns the
+// income collected since the last record, if any.
+func (gs *GameState) HandlePlayerState(p Player) int {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	units := map[int]Unit{}
+	for id, unit := range p.Units {
+		units[id] = unit
+	}
+	gs.Player.Units = units
+	earned := p.Resources - gs.Player.Resources
+	gs.Player.Resources = p.Resources
+	if earned <= 0 {
+		return 0
+	}
+	fmt.Printf("Collected %d resources, treasury is now %d\n", earned, p.Resources)
+	return earned
+}
+
 func (gs *GameState) UpdateUnit(u Unit) {
 	gs.mu.Lock()
 	defer gs.mu.Unlock()
@@ -65,6 +125,10 @@ func (gs *GameState) GetUsername() string {
 	return gs.Player.Username
 }
 
+func (gs *GameState) GetGameID() string {
+	return gs.GameID
+}
+
 func (gs *GameState) getUnitsSnap() []Unit {
 	gs.mu.RLock()
 	defer gs.mu.RUnlock()
@@ -90,7 +154,8 @@ func (gs *GameState) GetPlayerSnap() Player {
 		Units[k] = v
 	}
 	return Player{
-		Username: gs.Player.Username,
-		Units:    Units,
+		Username:  gs.Player.Username,
+		Units:     Units,
+		Resources: gs.Player.Resources,
 	}
 }
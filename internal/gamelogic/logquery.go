@@ -0,0 +1,249 @@
+package gamelogic
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+const defaultLogPageSize = 20
+
+// LogQuery filters the logs file. Zero values match everything.
+type LogQuery struct {
+	Username string
+	GameID   string
+	Event    string
+	Text     string
+	Since    time.Time
+	Until    time.Time
+	Page     int
+	PageSize int
+}
+
+func (q LogQuery) matches(r LogRecord) bool {
+	switch {
+	case q.Username != "" && r.Username != q.Username:
+		return false
+	case q.GameID != "" && r.GameID != q.GameID:
+		return false
+	case q.Event != "" && r.Event != q.Event:
+		return false
+	case !q.Since.IsZero() && r.Time.Before(q.Since):
+		return false
+	case !q.Until.IsZero() && r.Time.After(q.Until):
+		return false
+	case q.Text != "" && !strings.Contains(strings.ToLower(r.Message), strings.ToLower(q.Text)):
+		return false
+	}
+	return true
+}
+
+// parseLogTime accepts an RFC3339 timestamp or a duration meaning that long
+// ago, e.g. "1h30m".
+func parseLogTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error: %s is not a RFC3339 time or a duration", s)
+	}
+	return time.Now().Add(-d), nil
+}
+
+// ParseLogQuery parses the arguments of the logs command, e.g.
+// "logs user=bob since=1h search=asia page=2".
+func ParseLogQuery(words []string) (LogQuery, error) {
+	q := LogQuery{Page: 1, PageSize: defaultLogPageSize}
+	for _, word := range words[1:] {
+		key, value, ok := strings.Cut(word, "=")
+		if !ok {
+			return LogQuery{}, fmt.Errorf("error: expected key=value, got %s", word)
+		}
+		var err error
+		switch key {
+		case "user":
+			q.Username = value
+		case "game":
+			q.GameID = value
+		case "event":
+			q.Event = value
+		case "search":
+			q.Text = value
+		case "since":
+			q.Since, err = parseLogTime(value)
+		case "until":
+			q.Until, err = parseLogTime(value)
+		case "page":
+			q.Page, err = strconv.Atoi(value)
+			if err == nil && q.Page < 1 {
+				err = errors.New("error: page must be at least 1")
+			}
+		default:
+			err = fmt.Errorf("error: unknown filter %s", key)
+		}
+		if err != nil {
+			return LogQuery{}, err
+		}
+	}
+	return q, nil
+}
+
+// QueryLogs returns one page of matching records, newest first, and the total
+// number of matches. Rotated logs files are searched too.
+func QueryLogs(q LogQuery) ([]LogRecord, int, error) {
+	files, err := rotatedLogs()
+	if err != nil {
+		return nil, 0, fmt.Errorf("could not list rotated logs: %v", err)
+	}
+	files = append(files, logsFile)
+
+	matches := []LogRecord{}
+	for _, path := range files {
+		matches, err = scanLogs(path, q, matches)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	pageSize := q.PageSize
+	if pageSize <= 0 {
+		pageSize = defaultLogPageSize
+	}
+	page := q.Page
+	if page < 1 {
+		page = 1
+	}
+	// newest first
+	start := len(matches) - page*pageSize
+	end := start + pageSize
+	if end <= 0 {
+		return []LogRecord{}, len(matches), nil
+	}
+	if start < 0 {
+		start = 0
+	}
+	result := []LogRecord{}
+	for i := end - 1; i >= start; i-- {
+		result = append(result, matches[i])
+	}
+	return result, len(matches), nil
+}
+
+// readLogsFile opens path, transparently decompressing rotated files, and
+// passes it to read. Files that disappear because of a concurrent rotation
+// are skipped.
+func readLogsFile(path string, read func(io.Reader) error) error {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not open %s: %v", path, err)
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(path, gzipSuffix) {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("could not read %s: %v", path, err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+	return read(r)
+}
+
+// scanLogs appends the records in path matching q to matches.
+func scanLogs(path string, q LogQuery, matches []LogRecord) ([]LogRecord, error) {
+	err := readLogsFile(path, func(r io.Reader) error {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			var rec LogRecord
+			if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+				continue
+			}
+			if q.matches(rec) {
+				matches = append(matches, rec)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("could not read %s: %v", path, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return matches, nil
+}
+
+// Pages returns how many pages total matching records fill.
+func (q LogQuery) Pages(total int) int {
+	pageSize := q.PageSize
+	if pageSize <= 0 {
+		pageSize = defaultLogPageSize
+	}
+	return (total + pageSize - 1) / pageSize
+}
+
+func PrintLogs(records []LogRecord, total int, q LogQuery) {
+	if total == 0 {
+		fmt.Println("No matching logs.")
+		return
+	}
+	fmt.Printf("Page %d of %d (%d matching logs):\n", q.Page, q.Pages(total), total)
+	for _, r := range records {
+		fmt.Println(r)
+	}
+}
+
+var textLogLine = regexp.MustCompile(`^(\S+) (?:\[(\S+)\] )?([^:]+): (.*)$`)
+
+// ReadTextLogs parses a logs file in the old "time [game] user: message"
+// format so it can be imported.
+func ReadTextLogs(path string) ([]routing.GameLog, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open %s: %v", path, err)
+	}
+	defer f.Close()
+
+	gamelogs := []routing.GameLog{}
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		m := textLogLine.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			return nil, fmt.Errorf("%s:%d: not a game log line", path, line)
+		}
+		t, err := time.Parse(time.RFC3339, m[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		gamelogs = append(gamelogs, routing.GameLog{
+			CurrentTime: t,
+			GameID:      m[2],
+			Username:    m[3],
+			Message:     m[4],
+			Event:       routing.LogEventImported,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read %s: %v", path, err)
+	}
+	return gamelogs, nil
+}
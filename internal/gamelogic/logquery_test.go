@@ -0,0 +1,112 @@
+package gamelogic
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLogQuery(t *testing.T) {
+	since := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		words []string
+		want  LogQuery
+	}{
+		{
+			name:  "no filters",
+			words: []string{"logs"},
+			want:  LogQuery{Page: 1, PageSize: defaultLogPageSize},
+		},
+		{
+			name:  "every filter",
+			words: []string{"logs", "user=bob", "game=default", "event=war", "search=asia", "since=2024-05-01T12:00:00Z", "page=3"},
+			want: LogQuery{
+				Username: "bob",
+				GameID:   "default",
+				Event:    "war",
+				Text:     "asia",
+				Since:    since,
+				Page:     3,
+				PageSize: defaultLogPageSize,
+			},
+		},
+		{
+			name:  "values may contain =",
+			words: []string{"logs", "search=a=b"},
+			want:  LogQuery{Text: "a=b", Page: 1, PageSize: defaultLogPageSize},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLogQuery(tt.words)
+			if err != nil {
+				t.Fatalf("ParseLogQuery(%q) error = %v", tt.words, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseLogQuery(%q) = %+v, want %+v", tt.words, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseLogQueryDuration(t *testing.T) {
+	before := time.Now()
+	q, err := ParseLogQuery([]string{"logs", "since=90m", "until=30m"})
+	if err != nil {
+		t.Fatalf("ParseLogQuery() error = %v", err)
+	}
+	after := time.Now()
+	if q.Since.Before(before.Add(-90*time.Minute)) || q.Since.After(after.Add(-90*time.Minute)) {
+		t.Errorf("since = %v, want 90 minutes before %v", q.Since, before)
+	}
+	if q.Until.Before(before.Add(-30*time.Minute)) || q.Until.After(after.Add(-30*time.Minute)) {
+		t.Errorf("until = %v, want 30 minutes before %v", q.Until, before)
+	}
+}
+
+func TestParseLogQueryErrors(t *testing.T) {
+	for _, words := range [][]string{
+		{"logs", "bob"},
+		{"logs", "player=bob"},
+		{"logs", "since=yesterday"},
+		{"logs", "until="},
+		{"logs", "page=0"},
+		{"logs", "page=two"},
+	} {
+		if q, err := ParseLogQuery(words); err == nil {
+			t.Errorf("ParseLogQuery(%q) = %+v, want an error", words, q)
+		}
+	}
+}
+
+func TestLogQueryMatches(t *testing.T) {
+	rec := LogRecord{
+		Time:     time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		GameID:   "default",
+		Username: "bob",
+		Event:    "war",
+		Message:  "Bob won a battle in Asia",
+	}
+	tests := []struct {
+		name string
+		q    LogQuery
+		want bool
+	}{
+		{name: "empty query", q: LogQuery{}, want: true},
+		{name: "search ignores case", q: LogQuery{Text: "ASIA"}, want: true},
+		{name: "other user", q: LogQuery{Username: "alice"}, want: false},
+		{name: "other game", q: LogQuery{GameID: "other"}, want: false},
+		{name: "other event", q: LogQuery{Event: "message"}, want: false},
+		{name: "before since", q: LogQuery{Since: rec.Time.Add(time.Second)}, want: false},
+		{name: "after until", q: LogQuery{Until: rec.Time.Add(-time.Second)}, want: false},
+		{name: "within range", q: LogQuery{Since: rec.Time, Until: rec.Time}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.q.matches(rec); got != tt.want {
+				t.Errorf("matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
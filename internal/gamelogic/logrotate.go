@@ -0,0 +1,162 @@
+package gamelogic
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	rotatedLogsPrefix = "game-"
+	rotatedLogsLayout = "20060102T150405.000"
+	gzipSuffix        = ".gz"
+)
+
+// LogRotation controls when the logs file is rotated and how long rotated
+// files are kept. Zero values disable the corresponding rule.
+type LogRotation struct {
+	MaxSize  int64
+	Interval time.Duration
+	Compress bool
+	MaxFiles int
+	MaxAge   time.Duration
+}
+
+func (lw *LogWriter) shouldRotate() bool {
+	if lw.rotation.MaxSize > 0 && lw.size >= lw.rotation.MaxSize {
+		return true
+	}
+	if lw.rotation.Interval > 0 && time.Since(lw.openedAt) >= lw.rotation.Interval {
+		return true
+	}
+	return false
+}
+
+// rotate moves the current logs file aside and opens a new one. The caller
+// must hold lw.mu and the file lock.
+//
+// The old file stays open until the new one is, so if anything fails the
+// writer carries on appending to whichever file it has. Compressing and
+// pruning old files is best effort: the batch doesn't depend on it.
+func (lw *LogWriter) rotate() error {
+	if lw.size == 0 {
+		lw.openedAt = time.Now()
+		return nil
+	}
+	if err := lw.w.Flush(); err != nil {
+		return fmt.Errorf("could not flush logs file: %v", err)
+	}
+
+	ext := filepath.Ext(logsFile)
+	rotated := rotatedLogsPrefix + time.Now().UTC().Format(rotatedLogsLayout) + ext
+	if err := os.Rename(logsFile, rotated); err != nil {
+		return fmt.Errorf("could not rotate logs file: %v", err)
+	}
+	if err := lw.open(); err != nil {
+		return err
+	}
+	slog.Info("rotated game log", "path", rotated)
+
+	if lw.rotation.Compress {
+		if err := compressFile(rotated); err != nil {
+			slog.Error("failed to compress rotated game log", "path", rotated, "err", err)
+		}
+	}
+	if err := pruneLogs(lw.rotation); err != nil {
+		slog.Error("failed to prune rotated game logs", "err", err)
+	}
+	return nil
+}
+
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("could not open %s: %v", path, err)
+	}
+	defer src.Close()
+
+	dst, err := os.Create(path + gzipSuffix)
+	if err != nil {
+		return fmt.Errorf("could not create %s: %v", path+gzipSuffix, err)
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err = io.Copy(zw, src); err == nil {
+		err = zw.Close()
+	}
+	if err == nil {
+		err = dst.Sync()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path + gzipSuffix)
+		return fmt.Errorf("could not compress %s: %v", path, err)
+	}
+	return os.Remove(path)
+}
+
+// rotatedLogs returns the rotated logs files, oldest first.
+func rotatedLogs() ([]string, error) {
+	ext := filepath.Ext(logsFile)
+	matches, err := filepath.Glob(rotatedLogsPrefix + "*" + ext + "*")
+	if err != nil {
+		return nil, err
+	}
+	files := []string{}
+	for _, m := range matches {
+		if strings.HasSuffix(m, ext) || strings.HasSuffix(m, ext+gzipSuffix) {
+			files = append(files, m)
+		}
+	}
+	// the timestamp layout sorts lexically
+	sort.Strings(files)
+	return files, nil
+}
+
+func rotatedAt(path string) (time.Time, bool) {
+	ts := strings.TrimPrefix(path, rotatedLogsPrefix)
+	ts = strings.TrimSuffix(ts, gzipSuffix)
+	ts = strings.TrimSuffix(ts, filepath.Ext(logsFile))
+	t, err := time.Parse(rotatedLogsLayout, ts)
+	return t, err == nil
+}
+
+func pruneLogs(rotation LogRotation) error {
+	files, err := rotatedLogs()
+	if err != nil {
+		return fmt.Errorf("could not list rotated logs: %v", err)
+	}
+	remove := map[string]bool{}
+	if rotation.MaxFiles > 0 && len(files) > rotation.MaxFiles {
+		for _, f := range files[:len(files)-rotation.MaxFiles] {
+			remove[f] = true
+		}
+	}
+	if rotation.MaxAge > 0 {
+		for _, f := range files {
+			if t, ok := rotatedAt(f); ok && time.Since(t) > rotation.MaxAge {
+				remove[f] = true
+			}
+		}
+	}
+	for _, f := range files {
+		if !remove[f] {
+			continue
+		}
+		// another server sharing the directory may have got there first
+		if err := os.Remove(f); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("could not remove %s: %v", f, err)
+		}
+		slog.Info("removed old game log", "path", f)
+	}
+	return nil
+}
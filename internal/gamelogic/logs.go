@@ -1,32 +1,302 @@
 package gamelogic
 
 import (
+	"bufio"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"io/fs"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
 )
 
-const logsFile = "game.log"
+const (
+	logsFile = "game.jsonl"
+	// logsLockFile is locked by whichever server is appending to or rotating
+	// the logs file, so servers can share it.
+	logsLockFile = logsFile + ".lock"
+)
+
+// LogRecord is one line of the logs file.
+type LogRecord struct {
+	ID        string    `json:"id,omitempty"`
+	Time      time.Time `json:"time"`
+	WrittenAt time.Time `json:"written_at"`
+	GameID    string    `json:"game_id,omitempty"`
+	Username  string    `json:"username"`
+	Event     string    `json:"event"`
+	Message   string    `json:"message"`
+}
+
+func newLogRecord(gamelog routing.GameLog) LogRecord {
+	event := gamelog.Event
+	if event == "" {
+		event = routing.LogEventMessage
+	}
+	return LogRecord{
+		ID:       gamelog.ID,
+		Time:     gamelog.CurrentTime,
+		GameID:   gamelog.GameID,
+		Username: gamelog.Username,
+		Event:    event,
+		Message:  gamelog.Message,
+	}
+}
+
+func (r LogRecord) String() string {
+	if r.GameID != "" {
+		return fmt.Sprintf("%v [%v] %v (%v): %v", r.Time.Format(time.RFC3339), r.GameID, r.Username, r.Event, r.Message)
+	}
+	return fmt.Sprintf("%v %v (%v): %v", r.Time.Format(time.RFC3339), r.Username, r.Event, r.Message)
+}
 
-const writeToDiskSleep = 1 * time.Second
+// LogWriter appends game logs to the logs file as JSON Lines, in batches. A
+// batch is only reported as written once it has been fsynced. The file is
+// rotated between batches according to the writer's LogRotation.
+//
+// Servers started in the same directory share the logs file. Each batch is
+// written under a lock on logsLockFile, and a writer that finds the file was
+// rotated by another server switches to the new one before writing.
+//
+// Game logs carrying an ID already written within dedupWindow are dropped, so
+// redeliveries don't produce duplicate lines. The IDs are read back from the
+// logs files on startup, and lines appended by other servers sharing the file
+// are picked up before each batch, including the last lines of a file another
+// server rotated.
+type LogWriter struct {
+	mu       *sync.Mutex
+	lock     *os.File
+	f        *os.File
+	w        *bufio.Writer
+	size     int64
+	openedAt time.Time
+	rotation LogRotation
+	dedup    *logDeduper
 
-func WriteLog(gamelog routing.GameLog) error {
-	log.Printf("received game log...")
-	time.Sleep(writeToDiskSleep)
+	// unterminated is set when the file doesn't end in a newline, after a
+	// write that failed part way through.
+	unterminated bool
+}
 
-	f, err := os.OpenFile(logsFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+func NewLogWriter(rotation LogRotation, dedupWindow time.Duration) (*LogWriter, error) {
+	lw := &LogWriter{
+		mu:       &sync.Mutex{},
+		rotation: rotation,
+		dedup:    newLogDeduper(dedupWindow),
+	}
+	lock, err := os.OpenFile(logsLockFile, os.O_CREATE|os.O_RDWR, 0644)
 	if err != nil {
-		return fmt.Errorf("could not open logs file: %v", err)
+		return nil, fmt.Errorf("could not open logs lock file: %v", err)
+	}
+	lw.lock = lock
+	if err := lw.load(); err != nil {
+		if lw.f != nil {
+			lw.f.Close()
+		}
+		lock.Close()
+		return nil, err
+	}
+	if err := pruneLogs(rotation); err != nil {
+		lw.Close()
+		return nil, err
+	}
+	return lw, nil
+}
+
+// load opens the logs file and remembers the IDs recently written to it and
+// to the rotated files. It holds the file lock so no other server can write
+// or rotate in between.
+func (lw *LogWriter) load() error {
+	if err := lockFile(lw.lock); err != nil {
+		return fmt.Errorf("could not lock logs file: %v", err)
 	}
-	defer f.Close()
+	defer unlockFile(lw.lock)
 
-	str := fmt.Sprintf("%v %v: %v\n", gamelog.CurrentTime.Format(time.RFC3339), gamelog.Username, gamelog.Message)
-	_, err = f.WriteString(str)
+	if err := lw.dedup.loadFiles(); err != nil {
+		return err
+	}
+	if err := lw.open(); err != nil {
+		return err
+	}
+	lw.size = 0
+	return lw.catchUp()
+}
+
+// open opens the logs file, creating it if needed. The previously open file
+// is only closed once the new one is ready, so a failure leaves the writer
+// usable.
+func (lw *LogWriter) open() error {
+	f, err := os.OpenFile(logsFile, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
 	if err != nil {
+		return fmt.Errorf("could not open logs file: %v", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("could not stat logs file: %v", err)
+	}
+	if lw.f != nil {
+		// everything written to it has already been synced
+		lw.f.Close()
+	}
+	lw.f = f
+	lw.w = bufio.NewWriter(f)
+	lw.size = info.Size()
+	lw.openedAt = time.Now()
+	return nil
+}
+
+func (lw *LogWriter) WriteBatch(gamelogs []routing.GameLog) error {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+
+	if err := lockFile(lw.lock); err != nil {
+		return fmt.Errorf("could not lock logs file: %v", err)
+	}
+	defer unlockFile(lw.lock)
+
+	if err := lw.reopenIfRotated(); err != nil {
+		return err
+	}
+	if err := lw.catchUp(); err != nil {
+		return err
+	}
+	if lw.shouldRotate() {
+		if err := lw.rotate(); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	gamelogs = lw.dedup.filter(gamelogs)
+	start := lw.size
+	if err := lw.write(gamelogs, now); err != nil {
+		// bufio.Writer errors are sticky, so drop whatever is still buffered
+		// and forget the bytes that never made it to the file. Anything that
+		// did is picked up by the next catchUp.
+		lw.w.Reset(lw.f)
+		lw.size = start
+		return err
+	}
+
+	if lw.dedup.enabled() {
+		for _, gamelog := range gamelogs {
+			lw.dedup.mark(gamelog.ID, now)
+		}
+		lw.dedup.prune(now)
+	}
+	return nil
+}
+
+// write appends the game logs to the file and syncs it. The caller must hold
+// lw.mu.
+func (lw *LogWriter) write(gamelogs []routing.GameLog, writtenAt time.Time) error {
+	if lw.unterminated && len(gamelogs) > 0 {
+		if err := lw.w.WriteByte('\n'); err != nil {
+			return fmt.Errorf("could not write to logs file: %v", err)
+		}
+		lw.size++
+	}
+	for _, gamelog := range gamelogs {
+		rec := newLogRecord(gamelog)
+		rec.WrittenAt = writtenAt
+		line, err := json.Marshal(rec)
+		if err != nil {
+			return fmt.Errorf("could not encode game log: %v", err)
+		}
+		line = append(line, '\n')
+		if _, err = lw.w.Write(line); err != nil {
+			return fmt.Errorf("could not write to logs file: %v", err)
+		}
+		lw.size += int64(len(line))
+	}
+	if err := lw.w.Flush(); err != nil {
 		return fmt.Errorf("could not write to logs file: %v", err)
 	}
+	if err := lw.f.Sync(); err != nil {
+		return fmt.Errorf("could not sync logs file: %v", err)
+	}
+	if len(gamelogs) > 0 {
+		lw.unterminated = false
+	}
+	return nil
+}
+
+// reopenIfRotated switches to the current logs file if another server has
+// rotated the one we have open. The caller must hold lw.mu and the file lock.
+func (lw *LogWriter) reopenIfRotated() error {
+	current, err := os.Stat(logsFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return lw.open()
+	}
+	if err != nil {
+		return fmt.Errorf("could not stat logs file: %v", err)
+	}
+	info, err := lw.f.Stat()
+	if err != nil {
+		return fmt.Errorf("could not stat logs file: %v", err)
+	}
+	if os.SameFile(current, info) {
+		return nil
+	}
+	// the rotated file may have gained lines since our last batch
+	if err := lw.catchUp(); err != nil {
+		return err
+	}
+	if err := lw.open(); err != nil {
+		return err
+	}
+	// and everything in the new one was written by someone else
+	lw.size = 0
+	return nil
+}
+
+// catchUp reads the lines other servers appended to the logs file since our
+// last write, so their IDs count as seen. The caller must hold lw.mu and the
+// file lock.
+//
+// Since every server writes under the lock, a line without a newline at the
+// end of the file is never still being written: it was left by a write that
+// failed, and write terminates it before appending.
+func (lw *LogWriter) catchUp() error {
+	info, err := lw.f.Stat()
+	if err != nil {
+		return fmt.Errorf("could not stat logs file: %v", err)
+	}
+	if info.Size() <= lw.size {
+		return nil
+	}
+	if lw.dedup.enabled() {
+		if err := lw.dedup.load(io.NewSectionReader(lw.f, lw.size, info.Size()-lw.size)); err != nil {
+			return err
+		}
+	}
+	last := make([]byte, 1)
+	if _, err := lw.f.ReadAt(last, info.Size()-1); err != nil {
+		return fmt.Errorf("could not read logs file: %v", err)
+	}
+	lw.size = info.Size()
+	lw.unterminated = last[0] != '\n'
 	return nil
 }
+
+func (lw *LogWriter) WriteLog(gamelog routing.GameLog) error {
+	return lw.WriteBatch([]routing.GameLog{gamelog})
+}
+
+func (lw *LogWriter) Close() error {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	err := lw.w.Flush()
+	if cerr := lw.f.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := lw.lock.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,290 @@
+package gamelogic
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// chdirTemp runs the rest of the test in a new temp dir, since the logs
+// files live in the working directory.
+func chdirTemp(t *testing.T) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func newTestLogWriter(t *testing.T, rotation LogRotation, dedupWindow time.Duration) *LogWriter {
+	t.Helper()
+	lw, err := NewLogWriter(rotation, dedupWindow)
+	if err != nil {
+		t.Fatalf("NewLogWriter() error = %v", err)
+	}
+	return lw
+}
+
+// writeLogs writes a batch for each ID. Rotated files are named to the
+// millisecond, so batches are spaced out to keep them apart.
+func writeLogs(t *testing.T, lw *LogWriter, ids ...string) {
+	t.Helper()
+	for _, id := range ids {
+		gamelog := routing.GameLog{ID: id, CurrentTime: time.Now(), Username: "alice", GameID: "g1", Message: "log " + id}
+		if err := lw.WriteBatch([]routing.GameLog{gamelog}); err != nil {
+			t.Fatalf("WriteBatch(%s) error = %v", id, err)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+}
+
+// readIDs returns the IDs of the well-formed records in path.
+func readIDs(t *testing.T, path string) []string {
+	t.Helper()
+	ids := []string{}
+	err := readLogsFile(path, func(r io.Reader) error {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			var rec LogRecord
+			if json.Unmarshal(scanner.Bytes(), &rec) == nil {
+				ids = append(ids, rec.ID)
+			}
+		}
+		return scanner.Err()
+	})
+	if err != nil {
+		t.Fatalf("reading %s: %v", path, err)
+	}
+	return ids
+}
+
+// allIDs returns the IDs in every logs file, oldest first.
+func allIDs(t *testing.T) []string {
+	t.Helper()
+	files, err := rotatedLogs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{}
+	for _, path := range append(files, logsFile) {
+		ids = append(ids, readIDs(t, path)...)
+	}
+	return ids
+}
+
+func TestLogRotation(t *testing.T) {
+	tests := []struct {
+		name        string
+		rotation    LogRotation
+		wantRotated [][]string
+		compressed  bool
+	}{
+		{
+			name:        "rotates by size",
+			rotation:    LogRotation{MaxSize: 1},
+			wantRotated: [][]string{{"a"}, {"b"}},
+		},
+		{
+			name:        "compresses rotated files",
+			rotation:    LogRotation{MaxSize: 1, Compress: true},
+			wantRotated: [][]string{{"a"}, {"b"}},
+			compressed:  true,
+		},
+		{
+			name:        "keeps only the newest files",
+			rotation:    LogRotation{MaxSize: 1, MaxFiles: 1},
+			wantRotated: [][]string{{"b"}},
+		},
+		{
+			name:        "prunes compressed files",
+			rotation:    LogRotation{MaxSize: 1, Compress: true, MaxFiles: 1},
+			wantRotated: [][]string{{"b"}},
+			compressed:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chdirTemp(t)
+			lw := newTestLogWriter(t, tt.rotation, 0)
+			defer lw.Close()
+			writeLogs(t, lw, "a", "b", "c")
+
+			files, err := rotatedLogs()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := [][]string{}
+			for _, path := range files {
+				if strings.HasSuffix(path, gzipSuffix) != tt.compressed {
+					t.Errorf("rotated file %s, want compressed = %v", path, tt.compressed)
+				}
+				got = append(got, readIDs(t, path))
+			}
+			if !reflect.DeepEqual(got, tt.wantRotated) {
+				t.Errorf("rotated files hold %v, want %v", got, tt.wantRotated)
+			}
+			if current := readIDs(t, logsFile); !reflect.DeepEqual(current, []string{"c"}) {
+				t.Errorf("%s holds %v, want [c]", logsFile, current)
+			}
+		})
+	}
+}
+
+func TestLogPruneByAge(t *testing.T) {
+	chdirTemp(t)
+	old := rotatedLogsPrefix + time.Now().Add(-48*time.Hour).UTC().Format(rotatedLogsLayout) + ".jsonl" + gzipSuffix
+	recent := rotatedLogsPrefix + time.Now().Add(-time.Hour).UTC().Format(rotatedLogsLayout) + ".jsonl"
+	for _, path := range []string{old, recent} {
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lw := newTestLogWriter(t, LogRotation{MaxAge: 24 * time.Hour}, 0)
+	defer lw.Close()
+
+	files, err := rotatedLogs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(files, []string{recent}) {
+		t.Errorf("rotated files after pruning = %v, want [%s]", files, recent)
+	}
+}
+
+func TestLogDedupAfterRestart(t *testing.T) {
+	tests := []struct {
+		name     string
+		rotation LogRotation
+		before   []string
+		// damage runs between the two writers, as a crash might
+		damage func(t *testing.T)
+		after  []string
+		want   []string
+	}{
+		{
+			name:   "current file",
+			before: []string{"a"},
+			after:  []string{"a", "b"},
+			want:   []string{"a", "b"},
+		},
+		{
+			name:     "rotated file",
+			rotation: LogRotation{MaxSize: 1},
+			before:   []string{"a", "b"},
+			after:    []string{"a", "c"},
+			want:     []string{"a", "b", "c"},
+		},
+		{
+			name:     "rotated then compressed file",
+			rotation: LogRotation{MaxSize: 1, Compress: true},
+			before:   []string{"a", "b"},
+			after:    []string{"a", "c"},
+			want:     []string{"a", "b", "c"},
+		},
+		{
+			name:   "truncated last line",
+			before: []string{"a"},
+			damage: func(t *testing.T) {
+				f, err := os.OpenFile(logsFile, os.O_APPEND|os.O_WRONLY, 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer f.Close()
+				if _, err = f.WriteString(`{"id":"z","ti`); err != nil {
+					t.Fatal(err)
+				}
+			},
+			after: []string{"a", "b"},
+			want:  []string{"a", "b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chdirTemp(t)
+			lw := newTestLogWriter(t, tt.rotation, time.Hour)
+			writeLogs(t, lw, tt.before...)
+			if err := lw.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if tt.damage != nil {
+				tt.damage(t)
+			}
+
+			lw = newTestLogWriter(t, tt.rotation, time.Hour)
+			defer lw.Close()
+			writeLogs(t, lw, tt.after...)
+
+			if got := allIDs(t); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("logs hold %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// halfWriter writes half of what it is given to f and then fails, like a
+// disk filling up part way through a write.
+type halfWriter struct {
+	f *os.File
+}
+
+func (w halfWriter) Write(p []byte) (int, error) {
+	n, _ := w.f.Write(p[:len(p)/2])
+	return n, io.ErrShortWrite
+}
+
+func TestWriteBatchRecoversFromFailedWrite(t *testing.T) {
+	chdirTemp(t)
+	lw := newTestLogWriter(t, LogRotation{}, time.Hour)
+	defer lw.Close()
+	writeLogs(t, lw, "a")
+
+	lw.w = bufio.NewWriter(halfWriter{f: lw.f})
+	gamelog := routing.GameLog{ID: "b", CurrentTime: time.Now(), Username: "alice", Message: "log b"}
+	if err := lw.WriteBatch([]routing.GameLog{gamelog}); err == nil {
+		t.Fatal("WriteBatch() succeeded on a failing file")
+	}
+
+	// the redelivered batch and the next one are written on lines of their
+	// own, after the half-written line
+	writeLogs(t, lw, "b", "c")
+	if got := readIDs(t, logsFile); !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+		t.Errorf("logs hold %v, want [a b c]", got)
+	}
+	data, err := os.ReadFile(logsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 4 {
+		t.Errorf("logs file has %d lines, want 4 with the half-written one", lines)
+	}
+}
+
+func TestLogWritersShareFile(t *testing.T) {
+	chdirTemp(t)
+	first := newTestLogWriter(t, LogRotation{}, time.Hour)
+	defer first.Close()
+	second := newTestLogWriter(t, LogRotation{MaxSize: 1}, time.Hour)
+	defer second.Close()
+
+	writeLogs(t, first, "a")
+	// second catches up on the line first appended
+	writeLogs(t, second, "a", "b")
+	// and first on the line second wrote before rotating the file away
+	writeLogs(t, first, "b", "c")
+
+	if got := allIDs(t); !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+		t.Errorf("logs hold %v, want [a b c]", got)
+	}
+}
@@ -0,0 +1,36 @@
+package gamelogic
+
+import "github.com/bootdotdev/learn-pub-sub-starter/internal/metrics"
+
+var (
+	spawnedUnits = metrics.NewCounterVec(
+		"peril_spawns_total",
+		"Units spawned by players in this process, by rank.",
+		"rank",
+	)
+	movedArmies = metrics.NewCounter(
+		"peril_moves_total",
+		"Army moves made by players in this process.",
+	)
+	movedUnits = metrics.NewCounter(
+		"peril_moved_units_total",
+		"Units moved by players in this process.",
+	)
+	foughtWars = metrics.NewCounterVec(
+		"peril_wars_total",
+		"Wars players in this process handled, by side and outcome.",
+		"side", "outcome",
+	)
+)
+
+var warOutcomeName = map[WarOutcome]string{
+	WarOutcomeNotInvolved: "not_involved",
+	WarOutcomeNoUnits:     "no_units",
+	WarOutcomeYouWon:      "won",
+	WarOutcomeOpponentWon: "lost",
+	WarOutcomeDraw:        "draw",
+}
+
+func (wo WarOutcome) String() string {
+	return warOutcomeName[wo]
+}
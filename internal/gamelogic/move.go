@@ -3,7 +3,9 @@ package gamelogic
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"strconv"
+	"strings"
 )
 
 type MoveOutcome int
@@ -29,28 +31,51 @@ func (gs *GameState) HandleMove(move ArmyMove) MoveOutcome {
 		return MoveOutcomeSamePlayer
 	}
 
-	overlappingLocation := getOverlappingLocation(player, move.Player)
-	if overlappingLocation != "" {
-		fmt.Printf("You have units in %s! You are at war with %s!\n", overlappingLocation, move.Player.Username)
+	overlappingLocations := getOverlappingLocations(player, move.Player)
+	if len(overlappingLocations) > 0 && gs.IsAlliedWith(move.Player.Username) {
+		fmt.Printf("You share %s with %s, but you are at peace.\n", formatLocations(overlappingLocations), move.Player.Username)
+		return MoveOutComeSafe
+	}
+	if len(overlappingLocations) > 0 {
+		fmt.Printf("You have units in %s! You are at war with %s!\n", formatLocations(overlappingLocations), move.Player.Username)
 		return MoveOutcomeMakeWar
 	}
 	fmt.Printf("You are safe from %s's units.\n", move.Player.Username)
 	return MoveOutComeSafe
 }
 
-func getOverlappingLocation(p1 Player, p2 Player) Location {
-	for _, u1 := range p1.Units {
-		for _, u2 := range p2.Units {
-			if u1.Location == u2.Location {
-				return u1.Location
-			}
+// getOverlappingLocations returns every location both players hold, sorted
+// so that every client sees them in the same order.
+func getOverlappingLocations(p1 Player, p2 Player) []Location {
+	held := heldLocations(p2)
+	overlapping := []Location{}
+	for loc := range heldLocations(p1) {
+		if _, ok := held[loc]; ok {
+			overlapping = append(overlapping, loc)
 		}
 	}
-	return ""
+	sort.Slice(overlapping, func(i, j int) bool {
+		return overlapping[i] < overlapping[j]
+	})
+	return overlapping
+}
+
+// ContestedLocations returns every location where both players have units,
+// in the order their battles are fought.
+func ContestedLocations(p1 Player, p2 Player) []Location {
+	return getOverlappingLocations(p1, p2)
+}
+
+func formatLocations(locs []Location) string {
+	names := []string{}
+	for _, loc := range locs {
+		names = append(names, string(loc))
+	}
+	return strings.Join(names, ", ")
 }
 
 func (gs *GameState) CommandMove(words []string) (ArmyMove, error) {
-	if gs.isPaused() {
+	if gs.IsPaused() {
 		return ArmyMove{}, errors.New("the game is paused, you can not move units")
 	}
 	if len(words) < 3 {
@@ -82,11 +107,15 @@ func (gs *GameState) CommandMove(words []string) (ArmyMove, error) {
 		newUnits = append(newUnits, unit)
 	}
 
+	// the rest of the army stays hidden, the server shows each opponent
+	// what they can see of it
 	mv := ArmyMove{
 		ToLocation: newLocation,
 		Units:      newUnits,
-		Player:     gs.GetPlayerSnap(),
+		Player:     Player{Username: gs.GetUsername(), Units: map[int]Unit{}},
 	}
 	fmt.Printf("Moved %v units to %s\n", len(mv.Units), mv.ToLocation)
+	movedArmies.Inc()
+	movedUnits.Add(float64(len(mv.Units)))
 	return mv, nil
 }
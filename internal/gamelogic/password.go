@@ -0,0 +1,34 @@
+package gamelogic
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// GetPassword prompts for a line without echoing it, if stdin is a terminal
+// stty can control. The whole line is returned, spaces and all, minus the
+// line ending. It returns "" once stdin is closed.
+func GetPassword() string {
+	fmt.Print("> ")
+	if err := stty("-echo"); err == nil {
+		defer func() {
+			stty("echo")
+			// the newline the player typed wasn't echoed either
+			fmt.Println()
+		}()
+	}
+	scanner := bufio.NewScanner(os.Stdin)
+	if !scanner.Scan() {
+		return ""
+	}
+	return strings.TrimSuffix(scanner.Text(), "\r")
+}
+
+func stty(arg string) error {
+	cmd := exec.Command("stty", arg)
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
+}
@@ -2,6 +2,7 @@ package gamelogic
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
 )
@@ -9,11 +10,44 @@ import (
 func (gs *GameState) HandlePause(ps routing.PlayingState) {
 	defer fmt.Println("------------------------")
 	fmt.Println()
-	if ps.IsPaused {
+	switch {
+	case ps.IsPaused:
 		fmt.Println("==== Pause Detected ====")
-		gs.pauseGame()
-	} else {
+		gs.pauseGame(ps)
+	case ps.IsScheduled():
+		fmt.Println("==== Pause Scheduled ====")
+		gs.pauseGame(ps)
+	default:
 		fmt.Println("==== Resume Detected ====")
 		gs.resumeGame()
+		return
 	}
+	printPause(ps, time.Now())
+}
+
+// printPause describes a current or scheduled pause, counting down to when
+// it starts or ends.
+func printPause(ps routing.PlayingState, now time.Time) {
+	if ps.Reason != "" {
+		fmt.Printf("Reason: %s\n", ps.Reason)
+	}
+	if ps.IsScheduled() {
+		fmt.Printf("The game will pause in %v (at %s).\n", ps.StartedAt.Sub(now).Round(time.Second), ps.StartedAt.Format(time.Kitchen))
+		if !ps.ResumeAt.IsZero() {
+			fmt.Printf("It will resume %v later.\n", ps.ResumeAt.Sub(ps.StartedAt).Round(time.Second))
+		}
+		return
+	}
+	if !ps.StartedAt.IsZero() {
+		fmt.Printf("Paused for %v.\n", now.Sub(ps.StartedAt).Round(time.Second))
+	}
+	if ps.ResumeAt.IsZero() {
+		fmt.Println("The game will resume when the server resumes it.")
+		return
+	}
+	remaining := ps.ResumeAt.Sub(now).Round(time.Second)
+	if remaining < 0 {
+		remaining = 0
+	}
+	fmt.Printf("Resuming in %v (at %s).\n", remaining, ps.ResumeAt.Format(time.Kitchen))
 }
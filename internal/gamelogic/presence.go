@@ -0,0 +1,25 @@
+package gamelogic
+
+import (
+	"fmt"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+func (gs *GameState) HandleRosterEvent(p routing.Presence) bool {
+	if p.Username == gs.GetUsername() {
+		return false
+	}
+
+	switch p.Status {
+	case routing.PresenceJoined:
+		fmt.Printf("\n%s has joined the game.\n", p.Username)
+	case routing.PresenceLeft:
+		fmt.Printf("\n%s has left the game.\n", p.Username)
+	case routing.PresenceDisconnected:
+		fmt.Printf("\n%s has dropped from the game.\n", p.Username)
+	default:
+		return false
+	}
+	return true
+}
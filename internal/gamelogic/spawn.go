@@ -5,30 +5,48 @@ import (
 	"fmt"
 )
 
-func (gs *GameState) CommandSpawn(words []string) error {
+// CommandSpawn checks a spawn command and returns the spawn to ask the server
+// for. The unit is added by HandleSpawned once the server has spawned it.
+func (gs *GameState) CommandSpawn(words []string) (Spawn, error) {
+	if gs.IsPaused() {
+		return Spawn{}, errors.New("the game is paused, you can not spawn units")
+	}
 	if len(words) < 3 {
-		return errors.New("usage: spawn <location> <rank>")
+		return Spawn{}, errors.New("usage: spawn <location> <rank>")
 	}
 
 	locationName := words[1]
 	locations := getAllLocations()
 	if _, ok := locations[Location(locationName)]; !ok {
-		return fmt.Errorf("error: %s is not a valid location", locationName)
+		return Spawn{}, fmt.Errorf("error: %s is not a valid location", locationName)
 	}
 
 	rank := words[2]
 	units := getAllRanks()
 	if _, ok := units[UnitRank(rank)]; !ok {
-		return fmt.Errorf("error: %s is not a valid unit", rank)
+		return Spawn{}, fmt.Errorf("error: %s is not a valid unit", rank)
 	}
 
-	id := len(gs.getUnitsSnap()) + 1
-	gs.addUnit(Unit{
-		ID:       id,
-		Rank:     UnitRank(rank),
+	cost := getRankCosts()[UnitRank(rank)]
+	if resources := gs.GetPlayerSnap().Resources; resources < cost {
+		return Spawn{}, fmt.Errorf("error: not enough resources, need %d but have %d", cost, resources)
+	}
+
+	return Spawn{
+		Username: gs.GetUsername(),
 		Location: Location(locationName),
-	})
+		Rank:     UnitRank(rank),
+	}, nil
+}
+
+// HandleSpawned adds a unit the server spawned for us and takes our treasury
+// from the server, which paid for it.
+func (gs *GameState) HandleSpawned(result SpawnResult) {
+	unit := result.Unit
+	cost := getRankCosts()[unit.Rank]
+	gs.setResources(result.Resources)
+	gs.addUnit(unit)
 
-	fmt.Printf("Spawned a(n) %s in %s with id %v\n", rank, locationName, id)
-	return nil
+	fmt.Printf("Spawned a(n) %s in %s with id %v for %d resources\n", unit.Rank, unit.Location, unit.ID, cost)
+	spawnedUnits.With(string(unit.Rank)).Inc()
 }
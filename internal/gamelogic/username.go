@@ -0,0 +1,33 @@
+package gamelogic
+
+import (
+	"fmt"
+	"regexp"
+)
+
+const (
+	minUsernameLength = 3
+	maxUsernameLength = 20
+)
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*$`)
+
+// reservedUsernames are used by the server itself.
+var reservedUsernames = map[string]bool{
+	"server": true,
+	"admin":  true,
+}
+
+// ValidateUsername checks a username is safe to use in queue names and
+// routing keys.
+func ValidateUsername(username string) error {
+	switch {
+	case len(username) < minUsernameLength || len(username) > maxUsernameLength:
+		return fmt.Errorf("error: username must be %d to %d characters long", minUsernameLength, maxUsernameLength)
+	case !usernamePattern.MatchString(username):
+		return fmt.Errorf("error: username must start with a letter and contain only letters, digits, - and _")
+	case reservedUsernames[username]:
+		return fmt.Errorf("error: username %s is reserved", username)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package gamelogic
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+const scorePerLocation = 10
+
+// VictoryConditions describes how a game can be won. Zero values disable a
+// condition.
+type VictoryConditions struct {
+	Locations   int
+	Elimination bool
+	TimeLimit   time.Duration
+}
+
+func (vc VictoryConditions) String() string {
+	conds := []string{}
+	if vc.Locations > 0 {
+		conds = append(conds, fmt.Sprintf("control %d locations", vc.Locations))
+	}
+	if vc.Elimination {
+		conds = append(conds, "eliminate all opponents")
+	}
+	if vc.TimeLimit > 0 {
+		conds = append(conds, fmt.Sprintf("highest score after %v", vc.TimeLimit))
+	}
+	if len(conds) == 0 {
+		return "none"
+	}
+	return strings.Join(conds, ", ")
+}
+
+func Score(p Player) int {
+	units := []Unit{}
+	for _, unit := range p.Units {
+		units = append(units, unit)
+	}
+	return unitsToPowerLevel(units) + len(heldLocations(p))*scorePerLocation
+}
+
+// Standings ranks players by score, highest first.
+func Standings(players []Player) []routing.Standing {
+	standings := []routing.Standing{}
+	for _, p := range players {
+		standings = append(standings, routing.Standing{
+			Username:  p.Username,
+			Score:     Score(p),
+			Locations: len(heldLocations(p)),
+			Units:     len(p.Units),
+		})
+	}
+	sort.SliceStable(standings, func(i, j int) bool {
+		if standings[i].Score != standings[j].Score {
+			return standings[i].Score > standings[j].Score
+		}
+		return standings[i].Username < standings[j].Username
+	})
+	return standings
+}
+
+// CheckVictory evaluates the victory conditions against the server's record
+// of every army.
+func CheckVictory(vc VictoryConditions, armies []*Army, elapsed time.Duration) (routing.GameOver, bool) {
+	players := []Player{}
+	for _, a := range armies {
+		players = append(players, a.Snap())
+	}
+	gameOver := func(winner, reason string) (routing.GameOver, bool) {
+		return routing.GameOver{
+			Winner:    winner,
+			Reason:    reason,
+			Standings: Standings(players),
+			EndedAt:   time.Now(),
+		}, true
+	}
+
+	if vc.Locations > 0 {
+		for _, p := range players {
+			if held := len(heldLocations(p)); held >= vc.Locations {
+				return gameOver(p.Username, fmt.Sprintf("%s controls %d locations", p.Username, held))
+			}
+		}
+	}
+
+	if vc.Elimination && len(armies) > 1 {
+		remaining := []*Army{}
+		for _, a := range armies {
+			if !a.Eliminated() {
+				remaining = append(remaining, a)
+			}
+		}
+		if len(remaining) == 1 {
+			winner := remaining[0].Player.Username
+			return gameOver(winner, fmt.Sprintf("%s eliminated all opponents", winner))
+		}
+	}
+
+	if vc.TimeLimit > 0 && elapsed >= vc.TimeLimit && len(players) > 0 {
+		standings := Standings(players)
+		return gameOver(standings[0].Username, fmt.Sprintf("%s had the highest score after %v", standings[0].Username, vc.TimeLimit))
+	}
+
+	return routing.GameOver{}, false
+}
+
+func FormatStandings(standings []routing.Standing) string {
+	lines := []string{}
+	for i, s := range standings {
+		lines = append(lines, fmt.Sprintf("%d. %s: %d points (%d locations, %d units)", i+1, s.Username, s.Score, s.Locations, s.Units))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (gs *GameState) HandleGameOver(gameOver routing.GameOver) {
+	defer fmt.Println("------------------------")
+	fmt.Println()
+	fmt.Println("==== Game Over ====")
+	fmt.Println(gameOver.Reason)
+	if gameOver.Winner == gs.GetUsername() {
+		fmt.Println("You have won the game!")
+	} else {
+		fmt.Printf("%s has won the game.\n", gameOver.Winner)
+	}
+	fmt.Println("Final standings:")
+	fmt.Println(FormatStandings(gameOver.Standings))
+	gs.endGame()
+}
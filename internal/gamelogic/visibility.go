@@ -0,0 +1,42 @@
+package gamelogic
+
+// PlayerView returns a copy of the player that only reveals the units at the
+// given locations. The treasury is never revealed.
+func PlayerView(p Player, locs ...Location) Player {
+	visible := map[Location]struct{}{}
+	for _, loc := range locs {
+		visible[loc] = struct{}{}
+	}
+	units := map[int]Unit{}
+	for id, unit := range p.Units {
+		if _, ok := visible[unit.Location]; ok {
+			units[id] = unit
+		}
+	}
+	return Player{
+		Username: p.Username,
+		Units:    units,
+	}
+}
+
+func (gs *GameState) GetPlayerView(locs ...Location) Player {
+	return PlayerView(gs.GetPlayerSnap(), locs...)
+}
+
+// MoveView is what observer can see of a move: the units that moved, plus
+// mover's units in every location the observer holds.
+func MoveView(move ArmyMove, mover, observer Player) ArmyMove {
+	locs := []Location{}
+	for loc := range heldLocations(observer) {
+		locs = append(locs, loc)
+	}
+	player := PlayerView(mover, locs...)
+	for _, unit := range move.Units {
+		player.Units[unit.ID] = unit
+	}
+	return ArmyMove{
+		Player:     player,
+		Units:      move.Units,
+		ToLocation: move.ToLocation,
+	}
+}
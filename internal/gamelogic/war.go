@@ -2,6 +2,7 @@ package gamelogic
 
 import (
 	"fmt"
+	"math/rand"
 )
 
 type WarOutcome int
@@ -14,7 +15,29 @@ const (
 	WarOutcomeDraw
 )
 
-func (gs *GameState) HandleWar(rw RecognitionOfWar) (outcome WarOutcome, winner string, loser string) {
+// DeclareWar is called by the defender when an opponent's units are seen in
+// their locations. It resolves the defender's side of every battle and
+// returns the recognition to publish so the attacker can resolve theirs with
+// the same seed.
+func (gs *GameState) DeclareWar(move ArmyMove) (RecognitionOfWar, WarReport) {
+	locations := getOverlappingLocations(gs.GetPlayerSnap(), move.Player)
+	rw := RecognitionOfWar{
+		Attacker:  PlayerView(move.Player, locations...),
+		Defender:  gs.GetPlayerView(locations...),
+		Locations: locations,
+		Seed:      rand.Int63(),
+	}
+
+	defer fmt.Println("------------------------")
+	fmt.Println()
+	fmt.Println("==== War Declared ====")
+	fmt.Printf("%s has attacked you in %s!\n", rw.Attacker.Username, formatLocations(rw.Locations))
+	report := gs.fight(rw)
+	foughtWars.With("defender", gs.warOutcome(report).String()).Inc()
+	return rw, report
+}
+
+func (gs *GameState) HandleWar(rw RecognitionOfWar) (WarOutcome, WarReport) {
 	defer fmt.Println("------------------------")
 	fmt.Println()
 	fmt.Println("==== War Declared ====")
@@ -24,82 +47,75 @@ func (gs *GameState) HandleWar(rw RecognitionOfWar) (outcome WarOutcome, winner
 
 	if player.Username == rw.Defender.Username {
 		fmt.Printf("%s, you published the war.\n", player.Username)
-		return WarOutcomeNotInvolved, "", ""
+		return WarOutcomeNotInvolved, WarReport{}
 	}
 
 	if player.Username != rw.Attacker.Username {
 		fmt.Printf("%s, you are not involved in this war.\n", player.Username)
-		return WarOutcomeNotInvolved, "", ""
+		foughtWars.With("none", WarOutcomeNotInvolved.String()).Inc()
+		return WarOutcomeNotInvolved, WarReport{}
 	}
 
-	overlappingLocation := getOverlappingLocation(rw.Attacker, rw.Defender)
-	if overlappingLocation == "" {
+	if len(getOverlappingLocations(rw.Attacker, rw.Defender)) == 0 {
 		fmt.Printf("Error! No units are in the same location. No war will be fought.\n")
-		return WarOutcomeNoUnits, "", ""
+		foughtWars.With("attacker", WarOutcomeNoUnits.String()).Inc()
+		return WarOutcomeNoUnits, WarReport{}
 	}
 
-	attackerUnits := []Unit{}
-	defenderUnits := []Unit{}
-	for _, unit := range rw.Attacker.Units {
-		if unit.Location == overlappingLocation {
-			attackerUnits = append(attackerUnits, unit)
-		}
+	report := gs.fight(rw)
+	outcome := gs.warOutcome(report)
+	foughtWars.With("attacker", outcome.String()).Inc()
+	return outcome, report
+}
+
+func (gs *GameState) warOutcome(report WarReport) WarOutcome {
+	switch report.Winner() {
+	case "":
+		return WarOutcomeDraw
+	case gs.GetUsername():
+		return WarOutcomeYouWon
+	default:
+		return WarOutcomeOpponentWon
 	}
-	for _, unit := range rw.Defender.Units {
-		if unit.Location == overlappingLocation {
-			defenderUnits = append(defenderUnits, unit)
+}
+
+// ResolveWar fights a battle in every location of rw where both sides have
+// units. Each battle gets its own seed derived from the war's, so the
+// players and the server all get the same report from the same armies.
+func ResolveWar(rw RecognitionOfWar) WarReport {
+	report := WarReport{
+		Attacker: rw.Attacker.Username,
+		Defender: rw.Defender.Username,
+		Seed:     rw.Seed,
+	}
+	for i, loc := range rw.Locations {
+		if len(unitsAt(rw.Attacker, loc)) == 0 || len(unitsAt(rw.Defender, loc)) == 0 {
+			continue
 		}
+		report.Battles = append(report.Battles, ResolveBattle(rw.Attacker, rw.Defender, loc, rw.Seed+int64(i)))
 	}
+	return report
+}
 
-	fmt.Printf("%s's units:\n", rw.Attacker.Username)
-	for _, unit := range attackerUnits {
-		fmt.Printf("  * %v\n", unit.Rank)
+// fight resolves rw and removes our own casualties.
+func (gs *GameState) fight(rw RecognitionOfWar) WarReport {
+	report := ResolveWar(rw)
+	for _, battle := range report.Battles {
+		PrintBattleReport(battle)
 	}
-	fmt.Printf("%s's units:\n", rw.Defender.Username)
-	for _, unit := range defenderUnits {
-		fmt.Printf("  * %v\n", unit.Rank)
-	}
-	attackerPower := unitsToPowerLevel(attackerUnits)
-	defenderPower := unitsToPowerLevel(defenderUnits)
-	fmt.Printf("Attacker has a power level of %v\n", attackerPower)
-	fmt.Printf("Defender has a power level of %v\n", defenderPower)
-	if attackerPower > defenderPower {
-		fmt.Printf("%s has won the war!\n", rw.Attacker.Username)
-		if player.Username == rw.Defender.Username {
-			fmt.Println("You have lost the war!")
-			gs.removeUnitsInLocation(overlappingLocation)
-			fmt.Printf("Your units in %s have been killed.\n", overlappingLocation)
-			return WarOutcomeOpponentWon, rw.Attacker.Username, rw.Defender.Username
-		}
-		return WarOutcomeYouWon, rw.Attacker.Username, rw.Defender.Username
-	} else if defenderPower > attackerPower {
-		fmt.Printf("%s has won the war!\n", rw.Defender.Username)
-		if player.Username == rw.Attacker.Username {
-			fmt.Println("You have lost the war!")
-			gs.removeUnitsInLocation(overlappingLocation)
-			fmt.Printf("Your units in %s have been killed.\n", overlappingLocation)
-			return WarOutcomeOpponentWon, rw.Defender.Username, rw.Attacker.Username
-		}
-		return WarOutcomeYouWon, rw.Defender.Username, rw.Attacker.Username
+
+	losses := report.LossesOf(gs.GetUsername())
+	gs.removeUnits(losses)
+	if len(losses) > 0 {
+		fmt.Printf("You lost %d unit(s) across %d battle(s).\n", len(losses), len(report.Battles))
 	}
-	fmt.Println("The war ended in a draw!")
-	fmt.Printf("Your units in %s have been killed.\n", overlappingLocation)
-	gs.removeUnitsInLocation(overlappingLocation)
-	return WarOutcomeDraw, rw.Attacker.Username, rw.Defender.Username
+	return report
 }
 
 func unitsToPowerLevel(units []Unit) int {
 	power := 0
 	for _, unit := range units {
-		if unit.Rank == RankArtillery {
-			power += 10
-		}
-		if unit.Rank == RankCavalry {
-			power += 5
-		}
-		if unit.Rank == RankInfantry {
-			power += 1
-		}
+		power += getRankPower()[unit.Rank]
 	}
 	return power
 }
@@ -0,0 +1,58 @@
+// Package logging sets up the structured logger the binaries use for
+// diagnostics. Game narration and command output are printed to stdout;
+// logs go to stderr or a file so the two can be separated.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// Setup makes a logger at level ("debug", "info", "warn" or "error") in
+// format ("text" or "json") the default, writing to path, or stderr if path
+// is empty. The returned closer closes the file.
+func Setup(level, format, path string) (io.Closer, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q", level)
+	}
+
+	var w io.WriteCloser = nopCloser{os.Stderr}
+	if path != "" {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("could not open %s: %v", path, err)
+		}
+		w = f
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+	var h slog.Handler
+	switch format {
+	case "text":
+		h = slog.NewTextHandler(w, opts)
+	case "json":
+		h = slog.NewJSONHandler(w, opts)
+	default:
+		w.Close()
+		return nil, fmt.Errorf("invalid log format %q, want text or json", format)
+	}
+	slog.SetDefault(slog.New(h))
+	return w, nil
+}
+
+// Fatal logs msg at error level and exits.
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,330 @@
+// Package metrics keeps counters and histograms and serves them in the
+// Prometheus text exposition format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are histogram upper bounds in seconds, suited to message
+// handlers.
+var DefaultBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5}
+
+// Default is the registry the New functions register with and Handler
+// serves.
+var Default = NewRegistry()
+
+type metric interface {
+	write(w io.Writer) error
+}
+
+// Registry is a set of metrics written out in registration order.
+type Registry struct {
+	mu      *sync.Mutex
+	names   map[string]bool
+	metrics []metric
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		mu:    &sync.Mutex{},
+		names: map[string]bool{},
+	}
+}
+
+func (r *Registry) register(name string, m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[name] {
+		panic(fmt.Sprintf("metrics: %s registered twice", name))
+	}
+	r.names[name] = true
+	r.metrics = append(r.metrics, m)
+}
+
+// Write writes every metric in the Prometheus text format.
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	metrics := append([]metric{}, r.metrics...)
+	r.mu.Unlock()
+	for _, m := range metrics {
+		if err := m.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Handler serves the default registry.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := Default.Write(w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// Serve serves the default registry on addr at /metrics. It only returns
+// if the listener fails.
+func Serve(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", Handler())
+	return http.ListenAndServe(addr, mux)
+}
+
+// vec holds one series per combination of label values.
+type vec[T any] struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+	newT   func() T
+	mu     *sync.Mutex
+	series map[string]T
+	values map[string][]string
+}
+
+func newVec[T any](name, help, kind string, labels []string, newT func() T) *vec[T] {
+	return &vec[T]{
+		name:   name,
+		help:   help,
+		kind:   kind,
+		labels: labels,
+		newT:   newT,
+		mu:     &sync.Mutex{},
+		series: map[string]T{},
+		values: map[string][]string{},
+	}
+}
+
+func (v *vec[T]) with(values []string) T {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	s, ok := v.series[key]
+	if !ok {
+		s = v.newT()
+		v.series[key] = s
+		v.values[key] = append([]string{}, values...)
+	}
+	return s
+}
+
+// each calls f for every series in a stable order.
+func (v *vec[T]) each(f func(labels string, s T) error) error {
+	v.mu.Lock()
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	series := make([]T, len(keys))
+	labels := make([]string, len(keys))
+	for i, key := range keys {
+		series[i] = v.series[key]
+		labels[i] = formatLabels(v.labels, v.values[key])
+	}
+	v.mu.Unlock()
+
+	for i := range keys {
+		if err := f(labels[i], series[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v *vec[T]) writeHeader(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.name, escapeHelp(v.help), v.name, v.kind)
+	return err
+}
+
+// Counter is a value that only goes up.
+type Counter struct {
+	mu    *sync.Mutex
+	value float64
+}
+
+func newCounter() *Counter {
+	return &Counter{mu: &sync.Mutex{}}
+}
+
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add adds delta, which must not be negative.
+func (c *Counter) Add(delta float64) {
+	if delta < 0 {
+		panic("metrics: counter cannot decrease")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.value += delta
+}
+
+func (c *Counter) get() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.value
+}
+
+// CounterVec is a counter partitioned by labels.
+type CounterVec struct {
+	*vec[*Counter]
+}
+
+// NewCounterVec registers a counter with the default registry.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	cv := &CounterVec{newVec(name, help, "counter", labels, newCounter)}
+	Default.register(name, cv)
+	return cv
+}
+
+// NewCounter registers a counter without labels with the default registry.
+func NewCounter(name, help string) *Counter {
+	return NewCounterVec(name, help).With()
+}
+
+// With returns the counter for the given label values, in the order the
+// labels were declared.
+func (cv *CounterVec) With(values ...string) *Counter {
+	return cv.with(values)
+}
+
+func (cv *CounterVec) write(w io.Writer) error {
+	if err := cv.writeHeader(w); err != nil {
+		return err
+	}
+	return cv.each(func(labels string, c *Counter) error {
+		_, err := fmt.Fprintf(w, "%s%s %s\n", cv.name, labels, formatValue(c.get()))
+		return err
+	})
+}
+
+// Histogram counts observations into buckets.
+type Histogram struct {
+	mu      *sync.Mutex
+	bounds  []float64
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, bound := range h.bounds {
+		if v <= bound {
+			h.buckets[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+func (h *Histogram) snap() ([]uint64, uint64, float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]uint64{}, h.buckets...), h.count, h.sum
+}
+
+// HistogramVec is a histogram partitioned by labels.
+type HistogramVec struct {
+	*vec[*Histogram]
+	bounds []float64
+}
+
+// NewHistogramVec registers a histogram with the default registry. buckets
+// are upper bounds in increasing order.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	bounds := append([]float64{}, buckets...)
+	sort.Float64s(bounds)
+	hv := &HistogramVec{
+		vec: newVec(name, help, "histogram", labels, func() *Histogram {
+			return &Histogram{mu: &sync.Mutex{}, bounds: bounds, buckets: make([]uint64, len(bounds))}
+		}),
+		bounds: bounds,
+	}
+	Default.register(name, hv)
+	return hv
+}
+
+func (hv *HistogramVec) With(values ...string) *Histogram {
+	return hv.with(values)
+}
+
+func (hv *HistogramVec) write(w io.Writer) error {
+	if err := hv.writeHeader(w); err != nil {
+		return err
+	}
+	return hv.each(func(labels string, h *Histogram) error {
+		buckets, count, sum := h.snap()
+		for i, bound := range hv.bounds {
+			if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", hv.name, withLabel(labels, "le", formatValue(bound)), buckets[i]); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", hv.name, withLabel(labels, "le", "+Inf"), count); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%s_sum%s %s\n", hv.name, labels, formatValue(sum)); err != nil {
+			return err
+		}
+		_, err := fmt.Fprintf(w, "%s_count%s %d\n", hv.name, labels, count)
+		return err
+	})
+}
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf(`%s="%s"`, name, escapeLabel(values[i]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// withLabel adds one more label to already formatted labels.
+func withLabel(labels, name, value string) string {
+	pair := fmt.Sprintf(`%s="%s"`, name, value)
+	if labels == "" {
+		return "{" + pair + "}"
+	}
+	return labels[:len(labels)-1] + "," + pair + "}"
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
@@ -0,0 +1,98 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+// useRegistry points the New functions at a fresh registry for the rest of
+// the test.
+func useRegistry(t *testing.T) *Registry {
+	t.Helper()
+	old := Default
+	Default = NewRegistry()
+	t.Cleanup(func() { Default = old })
+	return Default
+}
+
+func TestRegistryWrite(t *testing.T) {
+	r := useRegistry(t)
+
+	messages := NewCounterVec("peril_messages_total", "Messages handled.\nBy queue and outcome, with \\ escaped.", "queue", "outcome")
+	messages.With("moves", "ack").Add(3)
+	messages.With(`war "north"`, "nack\\requeue").Inc()
+	messages.With("logs\nspam", "discard").Add(0.5)
+
+	latency := NewHistogramVec("peril_handler_seconds", "Handler latency.", []float64{1, 0.1, 0.5}, "queue")
+	latency.With("moves").Observe(0.05)
+	latency.With("moves").Observe(0.5)
+	latency.With("moves").Observe(2)
+	latency.With("logs").Observe(0.25)
+
+	NewCounter("peril_restarts_total", "Restarts.").Inc()
+	NewHistogramVec("peril_idle_seconds", "Never observed.", DefaultBuckets)
+
+	want := `# HELP peril_messages_total Messages handled.\nBy queue and outcome, with \\ escaped.
+# TYPE peril_messages_total counter
+peril_messages_total{queue="logs\nspam",outcome="discard"} 0.5
+peril_messages_total{queue="moves",outcome="ack"} 3
+peril_messages_total{queue="war \"north\"",outcome="nack\\requeue"} 1
+# HELP peril_handler_seconds Handler latency.
+# TYPE peril_handler_seconds histogram
+peril_handler_seconds_bucket{queue="logs",le="0.1"} 0
+peril_handler_seconds_bucket{queue="logs",le="0.5"} 1
+peril_handler_seconds_bucket{queue="logs",le="1"} 1
+peril_handler_seconds_bucket{queue="logs",le="+Inf"} 1
+peril_handler_seconds_sum{queue="logs"} 0.25
+peril_handler_seconds_count{queue="logs"} 1
+peril_handler_seconds_bucket{queue="moves",le="0.1"} 1
+peril_handler_seconds_bucket{queue="moves",le="0.5"} 2
+peril_handler_seconds_bucket{queue="moves",le="1"} 2
+peril_handler_seconds_bucket{queue="moves",le="+Inf"} 3
+peril_handler_seconds_sum{queue="moves"} 2.55
+peril_handler_seconds_count{queue="moves"} 3
+# HELP peril_restarts_total Restarts.
+# TYPE peril_restarts_total counter
+peril_restarts_total 1
+# HELP peril_idle_seconds Never observed.
+# TYPE peril_idle_seconds histogram
+`
+	var b strings.Builder
+	if err := r.Write(&b); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if got := b.String(); got != want {
+		t.Errorf("Write() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestHistogramWithoutLabels(t *testing.T) {
+	r := useRegistry(t)
+	NewHistogramVec("peril_spawn_seconds", "Spawn latency.", []float64{0.5}).With().Observe(0.5)
+
+	want := `# HELP peril_spawn_seconds Spawn latency.
+# TYPE peril_spawn_seconds histogram
+peril_spawn_seconds_bucket{le="0.5"} 1
+peril_spawn_seconds_bucket{le="+Inf"} 1
+peril_spawn_seconds_sum 0.5
+peril_spawn_seconds_count 1
+`
+	var b strings.Builder
+	if err := r.Write(&b); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if got := b.String(); got != want {
+		t.Errorf("Write() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRegisterTwicePanics(t *testing.T) {
+	useRegistry(t)
+	NewCounter("peril_twice_total", "Registered twice.")
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a name twice did not panic")
+		}
+	}()
+	NewCounter("peril_twice_total", "Registered twice.")
+}
@@ -0,0 +1,111 @@
+package moderation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+)
+
+// Config is the JSON rules file, e.g.
+//
+//	{
+//	  "max_length": 280,
+//	  "redact_words": ["darn"],
+//	  "reject_words": ["cheat"],
+//	  "patterns": [{"pattern": "https?://\\S+", "action": "redact"}],
+//	  "duplicate_window": "30s"
+//	}
+type Config struct {
+	MaxLength       int             `json:"max_length"`
+	RedactWords     []string        `json:"redact_words"`
+	RejectWords     []string        `json:"reject_words"`
+	Patterns        []PatternConfig `json:"patterns"`
+	DuplicateWindow string          `json:"duplicate_window"`
+}
+
+type PatternConfig struct {
+	Pattern string `json:"pattern"`
+	Action  string `json:"action"`
+}
+
+// DefaultConfig is used when there is no rules file.
+func DefaultConfig() Config {
+	return Config{
+		MaxLength:       500,
+		DuplicateWindow: "10s",
+	}
+}
+
+// LoadConfig reads the rules file at path, falling back to DefaultConfig if
+// it doesn't exist.
+func LoadConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return DefaultConfig(), nil
+	}
+	if err != nil {
+		return Config{}, fmt.Errorf("could not read %s: %v", path, err)
+	}
+	var cfg Config
+	if err = json.Unmarshal(data, &cfg); err != nil {
+		return Config{}, fmt.Errorf("could not parse %s: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// Build compiles the config into a pipeline. Rejections are checked before
+// redactions so a rejected message is reviewed as it was sent.
+func (cfg Config) Build() (*Pipeline, error) {
+	rules := []Rule{}
+	if cfg.MaxLength > 0 {
+		rules = append(rules, lengthRule{max: cfg.MaxLength})
+	}
+	if len(cfg.RejectWords) > 0 {
+		rule, err := newWordRule("reject_words", cfg.RejectWords, Reject)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	redactPatterns := []Rule{}
+	for _, p := range cfg.Patterns {
+		verdict, ok := parseVerdict(p.Action)
+		if !ok {
+			return nil, fmt.Errorf("unknown action %q for pattern %q", p.Action, p.Pattern)
+		}
+		re, err := regexp.Compile(p.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %v", p.Pattern, err)
+		}
+		rule := patternRule{name: "pattern " + p.Pattern, re: re, verdict: verdict}
+		if verdict == Redact {
+			redactPatterns = append(redactPatterns, rule)
+		} else {
+			rules = append(rules, rule)
+		}
+	}
+
+	if cfg.DuplicateWindow != "" {
+		window, err := time.ParseDuration(cfg.DuplicateWindow)
+		if err != nil {
+			return nil, fmt.Errorf("invalid duplicate_window: %v", err)
+		}
+		if window > 0 {
+			rules = append(rules, newDuplicateRule(window))
+		}
+	}
+
+	if len(cfg.RedactWords) > 0 {
+		rule, err := newWordRule("redact_words", cfg.RedactWords, Redact)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	rules = append(rules, redactPatterns...)
+	return NewPipeline(rules...), nil
+}
@@ -0,0 +1,95 @@
+package moderation
+
+import "strings"
+
+type Verdict int
+
+const (
+	Accept Verdict = iota
+	Redact
+	Reject
+)
+
+var verdictName = map[Verdict]string{
+	Accept: "accept",
+	Redact: "redact",
+	Reject: "reject",
+}
+
+func (v Verdict) String() string {
+	return verdictName[v]
+}
+
+func parseVerdict(s string) (Verdict, bool) {
+	for v, name := range verdictName {
+		if name == s {
+			return v, true
+		}
+	}
+	return Accept, false
+}
+
+// Result is a rule's decision on a message. Message is the text to keep,
+// which differs from the input when the verdict is Redact.
+type Result struct {
+	Verdict Verdict
+	Message string
+	Reason  string
+}
+
+// Rule checks a single message from username.
+type Rule interface {
+	Name() string
+	Check(username, message string) Result
+}
+
+// Retracter is implemented by rules that remember the messages they check.
+// Retract forgets a message that was never delivered after all, so a
+// redelivered copy isn't held against the player.
+type Retracter interface {
+	Retract(username, message string)
+}
+
+// Pipeline runs its rules in order. Redactions are fed to the following
+// rules and the first rejection stops the pipeline.
+type Pipeline struct {
+	rules []Rule
+}
+
+func NewPipeline(rules ...Rule) *Pipeline {
+	return &Pipeline{rules: rules}
+}
+
+func (p *Pipeline) Check(username, message string) Result {
+	result := Result{Verdict: Accept, Message: message}
+	reasons := []string{}
+	for _, rule := range p.rules {
+		r := rule.Check(username, result.Message)
+		switch r.Verdict {
+		case Reject:
+			r.Message = message
+			return r
+		case Redact:
+			result.Verdict = Redact
+			result.Message = r.Message
+			reasons = append(reasons, r.Reason)
+		}
+	}
+	result.Reason = strings.Join(reasons, "; ")
+	return result
+}
+
+// Retract undoes what the pipeline's rules remembered about a message it
+// checked. Rules that don't remember anything are run again to rebuild the
+// text each rule saw.
+func (p *Pipeline) Retract(username, message string) {
+	for _, rule := range p.rules {
+		if r, ok := rule.(Retracter); ok {
+			r.Retract(username, message)
+			continue
+		}
+		if r := rule.Check(username, message); r.Verdict == Redact {
+			message = r.Message
+		}
+	}
+}
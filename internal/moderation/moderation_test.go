@@ -0,0 +1,109 @@
+package moderation
+
+import (
+	"testing"
+	"time"
+)
+
+func testPipeline(t *testing.T, cfg Config) *Pipeline {
+	t.Helper()
+	p, err := cfg.Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	return p
+}
+
+func TestPipelineCheck(t *testing.T) {
+	p := testPipeline(t, Config{
+		MaxLength:   20,
+		RedactWords: []string{"darn"},
+		RejectWords: []string{"cheat"},
+		Patterns:    []PatternConfig{{Pattern: `https?://\S+`, Action: "redact"}},
+	})
+
+	tests := []struct {
+		name    string
+		message string
+		verdict Verdict
+		want    string
+	}{
+		{name: "clean", message: "hello there", verdict: Accept, want: "hello there"},
+		{name: "redacted word", message: "Darn it", verdict: Redact, want: "*** it"},
+		{name: "only whole words", message: "darning socks", verdict: Accept, want: "darning socks"},
+		{name: "redactions combine", message: "darn http://x.io", verdict: Redact, want: "*** ***"},
+		{name: "rejected word", message: "darn cheat", verdict: Reject, want: "darn cheat"},
+		{name: "too long", message: "this message is far too long", verdict: Reject, want: "this message is far too long"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := p.Check("player", tt.message)
+			if r.Verdict != tt.verdict || r.Message != tt.want {
+				t.Errorf("Check(%q) = %v %q, want %v %q", tt.message, r.Verdict, r.Message, tt.verdict, tt.want)
+			}
+			if r.Verdict != Accept && r.Reason == "" {
+				t.Errorf("Check(%q) gave no reason for %v", tt.message, r.Verdict)
+			}
+		})
+	}
+}
+
+func TestBuildRejectsInvalidConfig(t *testing.T) {
+	for _, cfg := range []Config{
+		{Patterns: []PatternConfig{{Pattern: "(", Action: "reject"}}},
+		{Patterns: []PatternConfig{{Pattern: "x", Action: "shout"}}},
+		{DuplicateWindow: "soon"},
+	} {
+		if _, err := cfg.Build(); err == nil {
+			t.Errorf("Build(%+v) succeeded, want an error", cfg)
+		}
+	}
+}
+
+func TestDuplicateRule(t *testing.T) {
+	r := newDuplicateRule(time.Minute)
+
+	if got := r.Check("alice", "attack at dawn"); got.Verdict != Accept {
+		t.Fatalf("first message = %v, want accept", got.Verdict)
+	}
+	if got := r.Check("alice", "Attack  at DAWN"); got.Verdict != Reject {
+		t.Fatalf("repeat = %v, want reject", got.Verdict)
+	}
+	if got := r.Check("bob", "attack at dawn"); got.Verdict != Accept {
+		t.Fatalf("another player's message = %v, want accept", got.Verdict)
+	}
+	if got := r.Check("alice", "retreat"); got.Verdict != Accept {
+		t.Fatalf("new message = %v, want accept", got.Verdict)
+	}
+
+	r.last["alice"] = sentMessage{message: "retreat", at: time.Now().Add(-2 * time.Minute)}
+	if got := r.Check("alice", "retreat"); got.Verdict != Accept {
+		t.Fatalf("repeat outside the window = %v, want accept", got.Verdict)
+	}
+}
+
+func TestRetractedMessageIsNotADuplicate(t *testing.T) {
+	p := testPipeline(t, Config{DuplicateWindow: "1m", RedactWords: []string{"darn"}})
+
+	first := p.Check("alice", "darn it")
+	if first.Verdict != Redact {
+		t.Fatalf("first check = %v, want redact", first.Verdict)
+	}
+	p.Retract("alice", "darn it")
+	if again := p.Check("alice", "darn it"); again.Verdict != Redact {
+		t.Fatalf("redelivered message = %v %q, want redact", again.Verdict, again.Reason)
+	}
+	if repeat := p.Check("alice", "darn it"); repeat.Verdict != Reject {
+		t.Fatalf("genuine repeat = %v, want reject", repeat.Verdict)
+	}
+}
+
+func TestRetractLeavesOtherMessages(t *testing.T) {
+	r := newDuplicateRule(time.Minute)
+	r.Check("alice", "first")
+	r.Check("alice", "second")
+	r.Retract("alice", "first")
+	if got := r.Check("alice", "second"); got.Verdict != Reject {
+		t.Fatalf("repeat after retracting an older message = %v, want reject", got.Verdict)
+	}
+}
@@ -0,0 +1,139 @@
+package moderation
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Moderator checks messages against the pipeline built from a rules file,
+// reloading it when the file changes, and counts verdicts per player.
+type Moderator struct {
+	path     string
+	mu       *sync.RWMutex
+	pipeline *Pipeline
+	modTime  time.Time
+	counts   map[string]map[Verdict]int
+}
+
+// PlayerCounts is how many of a player's messages were redacted and rejected.
+type PlayerCounts struct {
+	Username string
+	Redacted int
+	Rejected int
+}
+
+func NewModerator(path string) (*Moderator, error) {
+	m := &Moderator{
+		path:   path,
+		mu:     &sync.RWMutex{},
+		counts: map[string]map[Verdict]int{},
+	}
+	if err := m.Reload(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Reload rebuilds the pipeline from the rules file. The old pipeline stays
+// in place if the file is invalid.
+func (m *Moderator) Reload() error {
+	var modTime time.Time
+	if info, err := os.Stat(m.path); err == nil {
+		modTime = info.ModTime()
+	}
+	cfg, err := LoadConfig(m.path)
+	if err != nil {
+		return err
+	}
+	pipeline, err := cfg.Build()
+	if err != nil {
+		return fmt.Errorf("invalid moderation rules in %s: %v", m.path, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pipeline = pipeline
+	m.modTime = modTime
+	return nil
+}
+
+// Watch reloads the rules whenever the file's modification time changes.
+func (m *Moderator) Watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		var modTime time.Time
+		if info, err := os.Stat(m.path); err == nil {
+			modTime = info.ModTime()
+		}
+		m.mu.RLock()
+		changed := !modTime.Equal(m.modTime)
+		m.mu.RUnlock()
+		if !changed {
+			continue
+		}
+		if err := m.Reload(); err != nil {
+			slog.Error("failed to reload moderation rules", "path", m.path, "err", err)
+			m.mu.Lock()
+			m.modTime = modTime
+			m.mu.Unlock()
+			continue
+		}
+		slog.Info("reloaded moderation rules", "path", m.path)
+	}
+}
+
+func (m *Moderator) Check(username, message string) Result {
+	m.mu.RLock()
+	pipeline := m.pipeline
+	m.mu.RUnlock()
+
+	result := pipeline.Check(username, message)
+	if result.Verdict != Accept {
+		m.mu.Lock()
+		if m.counts[username] == nil {
+			m.counts[username] = map[Verdict]int{}
+		}
+		m.counts[username][result.Verdict]++
+		m.mu.Unlock()
+	}
+	return result
+}
+
+// Retract undoes Check for a message that could not be delivered and will
+// be checked again when it is redelivered. result is what Check returned.
+func (m *Moderator) Retract(username, message string, result Result) {
+	m.mu.Lock()
+	pipeline := m.pipeline
+	if result.Verdict != Accept && m.counts[username][result.Verdict] > 0 {
+		m.counts[username][result.Verdict]--
+	}
+	m.mu.Unlock()
+
+	pipeline.Retract(username, message)
+}
+
+// Counts returns the players with moderated messages, most rejections first.
+func (m *Moderator) Counts() []PlayerCounts {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	counts := []PlayerCounts{}
+	for username, c := range m.counts {
+		counts = append(counts, PlayerCounts{
+			Username: username,
+			Redacted: c[Redact],
+			Rejected: c[Reject],
+		})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Rejected != counts[j].Rejected {
+			return counts[i].Rejected > counts[j].Rejected
+		}
+		return counts[i].Username < counts[j].Username
+	})
+	return counts
+}
@@ -0,0 +1,117 @@
+package moderation
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const redaction = "***"
+
+// lengthRule rejects messages longer than max runes.
+type lengthRule struct {
+	max int
+}
+
+func (r lengthRule) Name() string {
+	return "length"
+}
+
+func (r lengthRule) Check(username, message string) Result {
+	if n := len([]rune(message)); n > r.max {
+		return Result{Verdict: Reject, Message: message, Reason: fmt.Sprintf("message is %d characters, the limit is %d", n, r.max)}
+	}
+	return Result{Verdict: Accept, Message: message}
+}
+
+// patternRule applies verdict to messages matching re. Redacting replaces
+// every match.
+type patternRule struct {
+	name    string
+	re      *regexp.Regexp
+	verdict Verdict
+}
+
+// newWordRule matches any of words as a whole word, ignoring case.
+func newWordRule(name string, words []string, verdict Verdict) (patternRule, error) {
+	quoted := make([]string, len(words))
+	for i, w := range words {
+		quoted[i] = regexp.QuoteMeta(w)
+	}
+	re, err := regexp.Compile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`)
+	if err != nil {
+		return patternRule{}, err
+	}
+	return patternRule{name: name, re: re, verdict: verdict}, nil
+}
+
+func (r patternRule) Name() string {
+	return r.name
+}
+
+func (r patternRule) Check(username, message string) Result {
+	if !r.re.MatchString(message) {
+		return Result{Verdict: Accept, Message: message}
+	}
+	if r.verdict == Redact {
+		return Result{Verdict: Redact, Message: r.re.ReplaceAllString(message, redaction), Reason: r.name}
+	}
+	return Result{Verdict: r.verdict, Message: message, Reason: r.name}
+}
+
+// duplicateRule rejects a player repeating their last message within window.
+// Every message checked is remembered, including rejected repeats, until it
+// is retracted.
+type duplicateRule struct {
+	window time.Duration
+	mu     *sync.Mutex
+	last   map[string]sentMessage
+}
+
+type sentMessage struct {
+	message string
+	at      time.Time
+}
+
+func newDuplicateRule(window time.Duration) *duplicateRule {
+	return &duplicateRule{
+		window: window,
+		mu:     &sync.Mutex{},
+		last:   map[string]sentMessage{},
+	}
+}
+
+func (r *duplicateRule) Name() string {
+	return "duplicate"
+}
+
+func (r *duplicateRule) Check(username, message string) Result {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	normalized := normalize(message)
+	prev, ok := r.last[username]
+	r.last[username] = sentMessage{message: normalized, at: now}
+	if ok && prev.message == normalized && now.Sub(prev.at) <= r.window {
+		return Result{Verdict: Reject, Message: message, Reason: "duplicate message"}
+	}
+	return Result{Verdict: Accept, Message: message}
+}
+
+// Retract forgets username's last message if it is message, so the same
+// message redelivered after a failed write or relay is not a repeat.
+func (r *duplicateRule) Retract(username, message string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if prev, ok := r.last[username]; ok && prev.message == normalize(message) {
+		delete(r.last, username)
+	}
+}
+
+// normalize ignores case and spacing when comparing messages.
+func normalize(message string) string {
+	return strings.ToLower(strings.Join(strings.Fields(message), " "))
+}
@@ -0,0 +1,382 @@
+package pubsub
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Headers carrying a message's signature.
+const (
+	SignerHeader      = "x-peril-signer"
+	CertificateHeader = "x-peril-certificate"
+	SignedAtHeader    = "x-peril-signed-at"
+	SignatureHeader   = "x-peril-signature"
+)
+
+// ServerSigner is the signer of messages signed with the server's own key.
+// The name is reserved, so no player can be issued a certificate for it.
+const ServerSigner = "server"
+
+// DefaultMaxSignatureAge is how old a signature may be before it is
+// rejected, which limits how long a captured message can be replayed.
+const DefaultMaxSignatureAge = time.Hour
+
+// Claimant is implemented by messages that claim to come from a player. A
+// verified message is rejected if its claimant is not the signer, unless the
+// server signed it, as it does when relaying players' messages.
+type Claimant interface {
+	ClaimedBy() string
+}
+
+// Certificate binds a player's public key to their name and game. The server
+// signs it when the player joins, so anyone holding the server's public key
+// can verify the player's messages without asking the server.
+type Certificate struct {
+	Username  string
+	GameID    string
+	PublicKey ed25519.PublicKey
+	IssuedAt  time.Time
+	Signature []byte
+}
+
+// signed is what the server's signature on c covers.
+func (c Certificate) signed() []byte {
+	b := []byte(c.Username)
+	b = append(b, 0)
+	b = append(b, c.GameID...)
+	b = append(b, 0)
+	b = append(b, c.PublicKey...)
+	return binary.BigEndian.AppendUint64(b, uint64(c.IssuedAt.UnixNano()))
+}
+
+func (c Certificate) encode() string {
+	data, err := json.Marshal(c)
+	if err != nil {
+		// a certificate is plain strings and bytes
+		panic(fmt.Sprintf("could not encode certificate: %v", err))
+	}
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+func decodeCertificate(s string) (Certificate, error) {
+	var c Certificate
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(data, &c)
+	return c, err
+}
+
+// Signer signs messages with a player's key, or with the server's.
+type Signer struct {
+	name     string
+	key      ed25519.PrivateKey
+	cert     string
+	issuedAt time.Time
+}
+
+// NewPlayerSigner signs as the player cert was issued to. key must be the
+// private half of cert.PublicKey.
+func NewPlayerSigner(key ed25519.PrivateKey, cert Certificate) *Signer {
+	return &Signer{name: cert.Username, key: key, cert: cert.encode(), issuedAt: cert.IssuedAt}
+}
+
+// IssuedAt is when the server certified the player's key, by the server's
+// clock. It is zero for the server's own signer.
+func (s *Signer) IssuedAt() time.Time {
+	return s.issuedAt
+}
+
+// NewServerSigner signs as ServerSigner.
+func NewServerSigner(key ed25519.PrivateKey) *Signer {
+	return &Signer{name: ServerSigner, key: key}
+}
+
+// NewKey returns a new key pair for a player to sign their messages with.
+func NewKey() (ed25519.PublicKey, ed25519.PrivateKey, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error generating key: %v", err)
+	}
+	return pub, priv, nil
+}
+
+// NewSecret returns 32 random bytes, e.g. a seed for ed25519.NewKeyFromSeed.
+func NewSecret() ([]byte, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("Error generating secret: %v", err)
+	}
+	return secret, nil
+}
+
+// signed is what a message's signature covers: the routing key and time as
+// well as the body, so a signed message can't be replayed under another key
+// or indefinitely.
+func signed(routingKey, signedAt string, body []byte) []byte {
+	b := []byte(routingKey)
+	b = append(b, 0)
+	b = append(b, signedAt...)
+	b = append(b, 0)
+	return append(b, body...)
+}
+
+func (s *Signer) sign(routingKey string, p *amqp.Publishing) {
+	signedAt := strconv.FormatInt(time.Now().UnixNano(), 10)
+	if p.Headers == nil {
+		p.Headers = amqp.Table{}
+	}
+	p.Headers[SignerHeader] = s.name
+	if s.cert != "" {
+		p.Headers[CertificateHeader] = s.cert
+	}
+	p.Headers[SignedAtHeader] = signedAt
+	p.Headers[SignatureHeader] = base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, signed(routingKey, signedAt, p.Body)))
+}
+
+// Verifier checks a delivery's signature and returns who signed it.
+type Verifier interface {
+	Verify(d amqp.Delivery) (string, error)
+}
+
+// Authority verifies messages against the server's public key: messages the
+// server signed itself, and messages players signed under certificates it
+// issued.
+type Authority struct {
+	key    ed25519.PublicKey
+	maxAge time.Duration
+}
+
+func NewAuthority(key ed25519.PublicKey, maxAge time.Duration) *Authority {
+	return &Authority{key: key, maxAge: maxAge}
+}
+
+// Server accepts only messages the server signed.
+func (a *Authority) Server() Verifier {
+	return &policy{authority: a, server: true}
+}
+
+// Players accepts messages signed by the server or by players of gameID.
+func (a *Authority) Players(gameID string) Verifier {
+	return &policy{authority: a, server: true, players: true, gameID: gameID}
+}
+
+// policy is a Verifier accepting the signers it allows. An empty gameID
+// allows players of every game.
+type policy struct {
+	authority *Authority
+	server    bool
+	players   bool
+	gameID    string
+	revoked   func(Certificate) bool
+}
+
+func (p *policy) Verify(d amqp.Delivery) (string, error) {
+	signer, _ := d.Headers[SignerHeader].(string)
+	signedAt, _ := d.Headers[SignedAtHeader].(string)
+	sig, _ := d.Headers[SignatureHeader].(string)
+	if signer == "" || signedAt == "" || sig == "" {
+		return "", errors.New("message is not signed")
+	}
+
+	key := p.authority.key
+	if signer == ServerSigner {
+		if !p.server {
+			return "", errors.New("message is signed by the server, not a player")
+		}
+	} else {
+		if !p.players {
+			return "", fmt.Errorf("message is signed by %s, not the server", signer)
+		}
+		encoded, _ := d.Headers[CertificateHeader].(string)
+		cert, err := decodeCertificate(encoded)
+		if err != nil {
+			return "", fmt.Errorf("bad certificate from %s", signer)
+		}
+		if cert.Username != signer || len(cert.PublicKey) != ed25519.PublicKeySize || !ed25519.Verify(p.authority.key, cert.signed(), cert.Signature) {
+			return "", fmt.Errorf("certificate of %s was not issued by the server", signer)
+		}
+		if p.gameID != "" && cert.GameID != p.gameID {
+			return "", fmt.Errorf("certificate of %s is for game %s", signer, cert.GameID)
+		}
+		if p.revoked != nil && p.revoked(cert) {
+			return "", fmt.Errorf("certificate of %s has been revoked", signer)
+		}
+		key = cert.PublicKey
+	}
+
+	got, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil || !ed25519.Verify(key, signed(d.RoutingKey, signedAt, d.Body), got) {
+		return "", fmt.Errorf("bad signature from %s", signer)
+	}
+
+	nanos, err := strconv.ParseInt(signedAt, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("bad signature time from %s", signer)
+	}
+	maxAge := p.authority.maxAge
+	if age := time.Since(time.Unix(0, nanos)); maxAge > 0 && (age > maxAge || age < -maxAge) {
+		return "", fmt.Errorf("signature from %s is %v old", signer, age.Round(time.Second))
+	}
+	return signer, nil
+}
+
+// KeyRing holds the server's private key. It issues players their
+// certificates and verifies their messages. Servers sharing a key verify
+// each other's certificates without coordinating, and certificates survive
+// a server restart.
+type KeyRing struct {
+	*Authority
+	key     ed25519.PrivateKey
+	mu      *sync.RWMutex
+	revoked map[string]time.Time
+	reject  func(username string) bool
+}
+
+func NewKeyRing(key ed25519.PrivateKey, maxAge time.Duration) *KeyRing {
+	return &KeyRing{
+		Authority: NewAuthority(key.Public().(ed25519.PublicKey), maxAge),
+		key:       key,
+		mu:        &sync.RWMutex{},
+		revoked:   map[string]time.Time{},
+	}
+}
+
+// PublicKey is what clients verify the server's messages and the
+// certificates it issues with.
+func (kr *KeyRing) PublicKey() ed25519.PublicKey {
+	return kr.Authority.key
+}
+
+// Signer signs the server's own messages.
+func (kr *KeyRing) Signer() *Signer {
+	return NewServerSigner(kr.key)
+}
+
+// Issue certifies that key belongs to username, playing gameID.
+func (kr *KeyRing) Issue(username, gameID string, key ed25519.PublicKey) Certificate {
+	cert := Certificate{
+		Username:  username,
+		GameID:    gameID,
+		PublicKey: key,
+		IssuedAt:  time.Now(),
+	}
+	cert.Signature = ed25519.Sign(kr.key, cert.signed())
+	return cert
+}
+
+// Revoke rejects every certificate issued to username so far. Certificates
+// issued afterwards are accepted. It returns the time of the revocation, for
+// the caller to keep so it can be restored after a restart.
+func (kr *KeyRing) Revoke(username string) time.Time {
+	now := time.Now()
+	kr.Restore(username, now)
+	return now
+}
+
+// Restore reinstates a revocation of username's certificates issued up to
+// at, unless a later one is already in place.
+func (kr *KeyRing) Restore(username string, at time.Time) {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	if at.After(kr.revoked[username]) {
+		kr.revoked[username] = at
+	}
+}
+
+// RejectIf also rejects every certificate of players reject reports, such as
+// banned ones, for as long as it reports them.
+func (kr *KeyRing) RejectIf(reject func(username string) bool) {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	kr.reject = reject
+}
+
+func (kr *KeyRing) isRevoked(cert Certificate) bool {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	if kr.reject != nil && kr.reject(cert.Username) {
+		return true
+	}
+	revokedAt, ok := kr.revoked[cert.Username]
+	return ok && !cert.IssuedAt.After(revokedAt)
+}
+
+// ForGame accepts only messages signed by players of gameID.
+func (kr *KeyRing) ForGame(gameID string) Verifier {
+	return &policy{authority: kr.Authority, players: true, gameID: gameID, revoked: kr.isRevoked}
+}
+
+// Players accepts only messages signed by players of any game.
+func (kr *KeyRing) Players() Verifier {
+	return &policy{authority: kr.Authority, players: true, revoked: kr.isRevoked}
+}
+
+// PublishOption modifies a message before it is published to key.
+type PublishOption func(key string, p *amqp.Publishing)
+
+// WithSigner signs the message. It must be the last option applied, after
+// anything else that changes the body.
+func WithSigner(s *Signer) PublishOption {
+	return func(key string, p *amqp.Publishing) {
+		if s != nil {
+			s.sign(key, p)
+		}
+	}
+}
+
+type subscribeOptions struct {
+	verifier    Verifier
+	replySigner *Signer
+}
+
+type SubscribeOption func(*subscribeOptions)
+
+// WithVerifier rejects messages that are unsigned, badly signed, or whose
+// Claimant is not the signer. Rejected messages are dead-lettered before
+// they reach the handler.
+func WithVerifier(v Verifier) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.verifier = v
+	}
+}
+
+// WithReplySigner signs the replies of a SubscribeJSONRPC handler.
+func WithReplySigner(s *Signer) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.replySigner = s
+	}
+}
+
+func newSubscribeOptions(opts []SubscribeOption) subscribeOptions {
+	o := subscribeOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+func (o subscribeOptions) check(d amqp.Delivery, target any) error {
+	if o.verifier == nil {
+		return nil
+	}
+	signer, err := o.verifier.Verify(d)
+	if err != nil {
+		return err
+	}
+	if c, ok := target.(Claimant); ok && signer != ServerSigner && c.ClaimedBy() != signer {
+		return fmt.Errorf("%s signed a message claiming to be from %s", signer, c.ClaimedBy())
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package pubsub
+
+import (
+	"crypto/ed25519"
+	"strings"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// signedDelivery is what a subscriber receives when s publishes body to key.
+func signedDelivery(s *Signer, key, body string) amqp.Delivery {
+	p := amqp.Publishing{Body: []byte(body)}
+	WithSigner(s)(key, &p)
+	return amqp.Delivery{RoutingKey: key, Headers: p.Headers, Body: p.Body}
+}
+
+func newTestKeyRing(t *testing.T) *KeyRing {
+	t.Helper()
+	_, key, err := NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewKeyRing(key, time.Hour)
+}
+
+func newTestPlayer(t *testing.T, kr *KeyRing, username, gameID string) *Signer {
+	t.Helper()
+	pub, priv, err := NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewPlayerSigner(priv, kr.Issue(username, gameID, pub))
+}
+
+func TestVerifyPlayers(t *testing.T) {
+	kr := newTestKeyRing(t)
+	alice := newTestPlayer(t, kr, "alice", "g1")
+
+	signer, err := kr.ForGame("g1").Verify(signedDelivery(alice, "chat.g1.alice", "hi"))
+	if err != nil || signer != "alice" {
+		t.Fatalf("Verify = %q, %v, want alice", signer, err)
+	}
+	if _, err = kr.Players().Verify(signedDelivery(alice, "chat.g1.alice", "hi")); err != nil {
+		t.Fatalf("any-game verifier rejected alice: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		d    func() amqp.Delivery
+		want string
+	}{
+		{"other game", func() amqp.Delivery {
+			return signedDelivery(newTestPlayer(t, kr, "bob", "g2"), "chat.g1.bob", "hi")
+		}, "is for game g2"},
+		{"tampered body", func() amqp.Delivery {
+			d := signedDelivery(alice, "chat.g1.alice", "hi")
+			d.Body = []byte("bye")
+			return d
+		}, "bad signature"},
+		{"replayed under another key", func() amqp.Delivery {
+			d := signedDelivery(alice, "chat.g1.alice", "hi")
+			d.RoutingKey = "chat.g1.bob"
+			return d
+		}, "bad signature"},
+		{"renamed signer", func() amqp.Delivery {
+			d := signedDelivery(alice, "chat.g1.alice", "hi")
+			d.Headers[SignerHeader] = "bob"
+			return d
+		}, "not issued by the server"},
+		{"certificate from another server", func() amqp.Delivery {
+			return signedDelivery(newTestPlayer(t, newTestKeyRing(t), "alice", "g1"), "chat.g1.alice", "hi")
+		}, "not issued by the server"},
+		{"server signature", func() amqp.Delivery {
+			return signedDelivery(kr.Signer(), "chat.g1.alice", "hi")
+		}, "not a player"},
+		{"unsigned", func() amqp.Delivery {
+			return amqp.Delivery{RoutingKey: "chat.g1.alice", Body: []byte("hi")}
+		}, "not signed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := kr.ForGame("g1").Verify(tt.d())
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Verify error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyRevoked(t *testing.T) {
+	kr := newTestKeyRing(t)
+	before := newTestPlayer(t, kr, "alice", "g1")
+	kr.Revoke("alice")
+	// certificates are ordered by time, so make sure the new one is later
+	time.Sleep(time.Millisecond)
+	after := newTestPlayer(t, kr, "alice", "g1")
+
+	if _, err := kr.ForGame("g1").Verify(signedDelivery(before, "k", "x")); err == nil {
+		t.Fatal("certificate issued before the revocation was accepted")
+	}
+	if _, err := kr.ForGame("g1").Verify(signedDelivery(after, "k", "x")); err != nil {
+		t.Fatalf("certificate issued after the revocation was rejected: %v", err)
+	}
+}
+
+func TestVerifyServer(t *testing.T) {
+	kr := newTestKeyRing(t)
+	authority := NewAuthority(kr.PublicKey(), time.Hour)
+
+	if _, err := authority.Server().Verify(signedDelivery(kr.Signer(), "pause.g1", "x")); err != nil {
+		t.Fatalf("server message rejected: %v", err)
+	}
+	if _, err := authority.Players("g1").Verify(signedDelivery(kr.Signer(), "pause.g1", "x")); err != nil {
+		t.Fatalf("server message rejected by the players verifier: %v", err)
+	}
+
+	alice := newTestPlayer(t, kr, "alice", "g1")
+	if _, err := authority.Server().Verify(signedDelivery(alice, "pause.g1", "x")); err == nil {
+		t.Fatal("player message accepted as the server's")
+	}
+
+	_, impostor, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = authority.Server().Verify(signedDelivery(NewServerSigner(impostor), "pause.g1", "x")); err == nil {
+		t.Fatal("message signed with another server key accepted")
+	}
+}
+
+type claim string
+
+func (c claim) ClaimedBy() string {
+	return string(c)
+}
+
+func TestCheckClaimant(t *testing.T) {
+	kr := newTestKeyRing(t)
+	alice := newTestPlayer(t, kr, "alice", "g1")
+	o := newSubscribeOptions([]SubscribeOption{WithVerifier(kr.Players())})
+
+	if err := o.check(signedDelivery(alice, "k", "x"), claim("alice")); err != nil {
+		t.Fatalf("alice's own message rejected: %v", err)
+	}
+	if err := o.check(signedDelivery(alice, "k", "x"), claim("bob")); err == nil {
+		t.Fatal("alice's message claiming to be from bob accepted")
+	}
+
+	relays := newSubscribeOptions([]SubscribeOption{WithVerifier(NewAuthority(kr.PublicKey(), time.Hour).Players("g1"))})
+	if err := relays.check(signedDelivery(kr.Signer(), "k", "x"), claim("bob")); err != nil {
+		t.Fatalf("server relay of bob's message rejected: %v", err)
+	}
+}
+
+func TestVerifyRestoredAndRejected(t *testing.T) {
+	kr := newTestKeyRing(t)
+	alice := newTestPlayer(t, kr, "alice", "g1")
+	bob := newTestPlayer(t, kr, "bob", "g1")
+
+	// a server restarted with the same key and the revocations it saved
+	restarted := NewKeyRing(kr.key, time.Hour)
+	restarted.Restore("alice", kr.Revoke("alice"))
+	if _, err := restarted.ForGame("g1").Verify(signedDelivery(alice, "k", "x")); err == nil {
+		t.Fatal("certificate revoked before the restart was accepted")
+	}
+
+	banned := map[string]bool{"bob": true}
+	restarted.RejectIf(func(username string) bool { return banned[username] })
+	if _, err := restarted.Players().Verify(signedDelivery(bob, "k", "x")); err == nil {
+		t.Fatal("banned player's certificate was accepted")
+	}
+	delete(banned, "bob")
+	if _, err := restarted.Players().Verify(signedDelivery(bob, "k", "x")); err != nil {
+		t.Fatalf("certificate rejected after the ban was lifted: %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package pubsub
+
+import (
+	"fmt"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// DeadLetter is a message waiting in a dead letter queue. Exchange and
+// RoutingKey are where it was originally published, and Queue is the queue
+// that rejected it.
+type DeadLetter struct {
+	Exchange    string
+	RoutingKey  string
+	ContentType string
+	Queue       string
+	Reason      string
+	Count       int64
+	DeadAt      time.Time
+	Body        []byte
+}
+
+// PeekQueue returns up to limit messages from the head of queue without
+// removing them, along with the number of messages in the queue. The
+// messages are fetched unacknowledged and requeued when the channel closes.
+func PeekQueue(conn *amqp.Connection, queue string, limit int) ([]DeadLetter, int, error) {
+	rabbitChan, err := conn.Channel()
+	if err != nil {
+		return nil, 0, fmt.Errorf("Failed to create RabbitMQ channel: %v", err)
+	}
+	defer rabbitChan.Close()
+
+	q, err := rabbitChan.QueueDeclarePassive(queue, true, false, false, false, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("Failed to inspect queue %s: %v", queue, err)
+	}
+
+	letters := []DeadLetter{}
+	for len(letters) < limit {
+		d, ok, err := rabbitChan.Get(queue, false)
+		if err != nil {
+			return nil, 0, fmt.Errorf("Failed to get message from %s: %v", queue, err)
+		}
+		if !ok {
+			break
+		}
+		letters = append(letters, newDeadLetter(d))
+	}
+	return letters, q.Messages, nil
+}
+
+// newDeadLetter reads the most recent entry of the x-death header RabbitMQ
+// adds when it dead-letters a message.
+func newDeadLetter(d amqp.Delivery) DeadLetter {
+	dl := DeadLetter{
+		Exchange:    d.Exchange,
+		RoutingKey:  d.RoutingKey,
+		ContentType: d.ContentType,
+		Body:        d.Body,
+	}
+	deaths, _ := d.Headers["x-death"].([]interface{})
+	if len(deaths) == 0 {
+		return dl
+	}
+	death, ok := deaths[0].(amqp.Table)
+	if !ok {
+		return dl
+	}
+	if exchange, ok := death["exchange"].(string); ok {
+		dl.Exchange = exchange
+	}
+	if queue, ok := death["queue"].(string); ok {
+		dl.Queue = queue
+	}
+	if reason, ok := death["reason"].(string); ok {
+		dl.Reason = reason
+	}
+	if count, ok := death["count"].(int64); ok {
+		dl.Count = count
+	}
+	if t, ok := death["time"].(time.Time); ok {
+		dl.DeadAt = t
+	}
+	return dl
+}
@@ -0,0 +1,35 @@
+package pubsub
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// NewMessageID returns a random ID, which identifies a published message in
+// logs on both ends and lets the server drop duplicate game logs. It panics
+// if the system's random source fails: an ID that isn't random could get
+// another player's message dropped as a duplicate.
+func NewMessageID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("could not generate message ID: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
+
+// deliveryLogger returns the default logger with fields identifying d.
+func deliveryLogger(d amqp.Delivery) *slog.Logger {
+	l := slog.With(
+		"exchange", d.Exchange,
+		"routing_key", d.RoutingKey,
+		"message_id", d.MessageId,
+	)
+	if signer, ok := d.Headers[SignerHeader].(string); ok {
+		l = l.With("username", signer)
+	}
+	return l
+}
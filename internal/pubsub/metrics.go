@@ -0,0 +1,136 @@
+package pubsub
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/metrics"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var (
+	publishedMessages = metrics.NewCounterVec(
+		"peril_pubsub_published_total",
+		"Messages published, by exchange and routing key prefix.",
+		"exchange", "prefix",
+	)
+	publishErrors = metrics.NewCounterVec(
+		"peril_pubsub_publish_errors_total",
+		"Messages that failed to publish, by exchange and routing key prefix.",
+		"exchange", "prefix",
+	)
+	consumedMessages = metrics.NewCounterVec(
+		"peril_pubsub_consumed_total",
+		"Messages delivered to subscribers, by exchange and binding key.",
+		"exchange", "binding",
+	)
+	settledMessages = metrics.NewCounterVec(
+		"peril_pubsub_settled_total",
+		"Consumed messages by binding key and how they were settled: ack, nack_requeue, nack_discard, rejected or malformed.",
+		"exchange", "binding", "outcome",
+	)
+	handlerSeconds = metrics.NewHistogramVec(
+		"peril_pubsub_handler_seconds",
+		"Time handlers spent on a message or batch, by exchange and binding key.",
+		metrics.DefaultBuckets,
+		"exchange", "binding",
+	)
+	connections = metrics.NewCounterVec(
+		"peril_pubsub_connections_total",
+		"Attempts to connect to RabbitMQ, by result.",
+		"result",
+	)
+	reconnects = metrics.NewCounter(
+		"peril_pubsub_reconnects_total",
+		"Connections made after an earlier one in the same process.",
+	)
+	connectionsLost = metrics.NewCounter(
+		"peril_pubsub_connections_lost_total",
+		"Connections RabbitMQ closed with an error.",
+	)
+)
+
+// Outcomes recorded for messages that never reached a handler.
+const (
+	outcomeRejected  = "rejected"
+	outcomeMalformed = "malformed"
+)
+
+var connected atomic.Bool
+
+// Dial connects to RabbitMQ and records the attempt, and the connection
+// being lost, in the connection metrics.
+func Dial(url string) (*amqp.Connection, error) {
+	conn, err := amqp.Dial(url)
+	if err != nil {
+		connections.With("error").Inc()
+		return nil, err
+	}
+	connections.With("ok").Inc()
+	if connected.Swap(true) {
+		reconnects.Inc()
+	}
+	go func() {
+		if err := <-conn.NotifyClose(make(chan *amqp.Error, 1)); err != nil {
+			connectionsLost.Inc()
+		}
+	}()
+	return conn, nil
+}
+
+// Metrics are never labelled with a full routing key: keys name players,
+// and anyone can publish with a made-up key, so each would add a series.
+// Publishes are labelled with the key's first word and deliveries with the
+// key the subscriber bound.
+
+// keyPrefix is the first word of a routing key, e.g. army_moves for
+// army_moves.default.bob.
+func keyPrefix(key string) string {
+	prefix, _, _ := strings.Cut(key, ".")
+	return prefix
+}
+
+func recordPublish(exchange, key string, err error) {
+	if err != nil {
+		publishErrors.With(exchange, keyPrefix(key)).Inc()
+		return
+	}
+	publishedMessages.With(exchange, keyPrefix(key)).Inc()
+}
+
+func recordConsume(exchange, binding string) {
+	consumedMessages.With(exchange, binding).Inc()
+}
+
+func recordSettle(exchange, binding, outcome string) {
+	settledMessages.With(exchange, binding, outcome).Inc()
+}
+
+// timeHandler observes how long the handler for the binding took since
+// start.
+func timeHandler(exchange, binding string, start time.Time) {
+	handlerSeconds.With(exchange, binding).Observe(time.Since(start).Seconds())
+}
+
+// settle acks or nacks d as the handler asked and records the outcome
+// against the binding it was consumed through.
+func settle(d amqp.Delivery, ack AckType, exchange, binding string) {
+	switch ack {
+	case Ack:
+		d.Ack(false)
+	case NackRequeue:
+		d.Nack(false, true)
+	case NackDiscard:
+		d.Nack(false, false)
+	default:
+		deliveryLogger(d).Error("unknown ack type", "ack", int(ack))
+		return
+	}
+	recordSettle(exchange, binding, ack.String())
+	if slog.Default().Enabled(context.Background(), slog.LevelDebug) {
+		deliveryLogger(d).Debug("handled message", "outcome", ack.String())
+	}
+}
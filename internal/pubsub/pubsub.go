@@ -5,7 +5,13 @@ import (
 	"context"
 	"encoding/gob"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/tracing"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
@@ -34,7 +40,17 @@ const (
 	NackDiscard
 )
 
-func PublishGob[T any](ch *amqp.Channel, exchange, key string, val T) error {
+var ackTypeName = map[AckType]string{
+	Ack:         "ack",
+	NackRequeue: "nack_requeue",
+	NackDiscard: "nack_discard",
+}
+
+func (at AckType) String() string {
+	return ackTypeName[at]
+}
+
+func PublishGob[T any](ch *amqp.Channel, exchange, key string, val T, opts ...PublishOption) error {
 	var buf bytes.Buffer
 	enc := gob.NewEncoder(&buf)
 
@@ -42,16 +58,31 @@ func PublishGob[T any](ch *amqp.Channel, exchange, key string, val T) error {
 		return fmt.Errorf("Error encoding to Gob: %v", err)
 	}
 
-	return ch.PublishWithContext(context.Background(), exchange, key, false, false, amqp.Publishing{ContentType: "application/gob", Body: buf.Bytes()})
+	return publish(ch, exchange, key, amqp.Publishing{ContentType: "application/gob", Body: buf.Bytes()}, opts)
 }
 
-func PublishJSON[T any](ch *amqp.Channel, exchange, key string, val T) error {
+func PublishJSON[T any](ch *amqp.Channel, exchange, key string, val T, opts ...PublishOption) error {
 	valJson, err := json.Marshal(val)
 	if err != nil {
 		return fmt.Errorf("Error marshalling to JSON: %v", err)
 	}
 
-	return ch.PublishWithContext(context.Background(), exchange, key, false, false, amqp.Publishing{ContentType: "application/json", Body: valJson})
+	return publish(ch, exchange, key, amqp.Publishing{ContentType: "application/json", Body: valJson}, opts)
+}
+
+func publish(ch *amqp.Channel, exchange, key string, p amqp.Publishing, opts []PublishOption) error {
+	if p.MessageId == "" {
+		p.MessageId = NewMessageID()
+	}
+	for _, opt := range opts {
+		opt(key, &p)
+	}
+	span := startPublishSpan(exchange, key, &p)
+	defer span.End()
+	err := ch.PublishWithContext(context.Background(), exchange, key, false, false, p)
+	span.SetError(err)
+	recordPublish(exchange, key, err)
+	return err
 }
 
 func SubscribeGob[T any](
@@ -61,6 +92,7 @@ func SubscribeGob[T any](
 	key string,
 	queueType SimpleQueueType,
 	handler func(T) AckType,
+	opts ...SubscribeOption,
 ) error {
 	unmarshaller := func(data []byte) (T, error) {
 		buf := bytes.NewBuffer(data)
@@ -70,7 +102,7 @@ func SubscribeGob[T any](
 		return target, err
 	}
 
-	return subscribe(conn, exchange, queueName, key, queueType, handler, unmarshaller)
+	return subscribe(conn, exchange, queueName, key, queueType, ignoreContext(handler), unmarshaller, opts)
 }
 
 func SubscribeJSON[T any](
@@ -80,6 +112,22 @@ func SubscribeJSON[T any](
 	key string,
 	queueType SimpleQueueType,
 	handler func(T) AckType,
+	opts ...SubscribeOption,
+) error {
+	return SubscribeJSONContext(conn, exchange, queueName, key, queueType, ignoreContext(handler), opts...)
+}
+
+// SubscribeJSONContext is like SubscribeJSON, but the handler is also given
+// a context holding the span it runs in. Publishing with WithContext(ctx)
+// from the handler continues the message's trace.
+func SubscribeJSONContext[T any](
+	conn *amqp.Connection,
+	exchange,
+	queueName,
+	key string,
+	queueType SimpleQueueType,
+	handler func(context.Context, T) AckType,
+	opts ...SubscribeOption,
 ) error {
 	unmarshaller := func(data []byte) (T, error) {
 		var target T
@@ -87,7 +135,40 @@ func SubscribeJSON[T any](
 		return target, err
 	}
 
-	return subscribe(conn, exchange, queueName, key, queueType, handler, unmarshaller)
+	return subscribe(conn, exchange, queueName, key, queueType, handler, unmarshaller, opts)
+}
+
+func ignoreContext[T any](handler func(T) AckType) func(context.Context, T) AckType {
+	return func(_ context.Context, target T) AckType {
+		return handler(target)
+	}
+}
+
+// SubscribeGobBatch delivers messages to handler in batches of up to
+// batchSize, or whatever has arrived once interval passes. The handler
+// returns one AckType per message. Acks are sent with a single multiple-ack
+// once the handler returns, so a batch is only acknowledged after the handler
+// has finished with it.
+func SubscribeGobBatch[T any](
+	conn *amqp.Connection,
+	exchange,
+	queueName,
+	key string,
+	queueType SimpleQueueType,
+	batchSize int,
+	interval time.Duration,
+	handler func([]T) []AckType,
+	opts ...SubscribeOption,
+) error {
+	unmarshaller := func(data []byte) (T, error) {
+		buf := bytes.NewBuffer(data)
+		dec := gob.NewDecoder(buf)
+		var target T
+		err := dec.Decode(&target)
+		return target, err
+	}
+
+	return subscribeBatch(conn, exchange, queueName, key, queueType, batchSize, interval, handler, unmarshaller, opts)
 }
 
 func subscribe[T any](
@@ -96,9 +177,12 @@ func subscribe[T any](
 	queueName,
 	key string,
 	queueType SimpleQueueType,
-	handler func(T) AckType,
+	handler func(context.Context, T) AckType,
 	unmarshaller func([]byte) (T, error),
+	opts []SubscribeOption,
 ) error {
+	o := newSubscribeOptions(opts)
+
 	rabbitChan, queue, err := DeclareAndBind(conn, exchange, queueName, key, queueType)
 	if err != nil {
 		return fmt.Errorf("Failed to declare and bind queue: %v", err)
@@ -116,23 +200,32 @@ func subscribe[T any](
 	go func() {
 		defer rabbitChan.Close()
 		for delivery := range deliveryChan {
+			recordConsume(exchange, key)
+			ctx, span := startConsumeSpan(key, queueName, delivery)
 			target, err := unmarshaller(delivery.Body)
 			if err != nil {
-				fmt.Printf("Could not unmarshall message: %v\n", err)
+				deliveryLogger(delivery).Warn("could not unmarshal message", "err", err)
+				delivery.Nack(false, false)
+				recordSettle(exchange, key, outcomeMalformed)
+				span.SetError(err)
+				span.End()
 				continue
 			}
-
-			ack := handler(target)
-			switch ack {
-			case Ack:
-				delivery.Ack(false)
-			case NackRequeue:
-				delivery.Nack(false, true)
-			case NackDiscard:
+			if err = o.check(delivery, target); err != nil {
+				deliveryLogger(delivery).Warn("rejected message", "err", err)
 				delivery.Nack(false, false)
-			default:
-				fmt.Println("Unkown ackType!")
+				recordSettle(exchange, key, outcomeRejected)
+				span.SetError(err)
+				span.End()
+				continue
 			}
+
+			start := time.Now()
+			ack := handler(ctx, target)
+			timeHandler(exchange, key, start)
+			settle(delivery, ack, exchange, key)
+			span.SetAttribute("outcome", ack.String())
+			span.End()
 		}
 	}()
 
@@ -174,9 +267,172 @@ func DeclareAndBind(
 		return nil, amqp.Queue{}, fmt.Errorf("Failed to declare queue: %v", err)
 	}
 
+	// every queue is bound to the default exchange by its name already
+	if exchange == "" {
+		return rabbitChan, rabbitQueue, nil
+	}
 	if err = rabbitChan.QueueBind(rabbitQueue.Name, key, exchange, false, nil); err != nil {
 		return nil, amqp.Queue{}, fmt.Errorf("Failed to bind exchange to queue: %v", err)
 	}
 
 	return rabbitChan, rabbitQueue, nil
 }
+
+// ClaimQueue declares an exclusive queue to serve as a lock, held for as
+// long as conn is open. It reports false if another connection holds it.
+func ClaimQueue(conn *amqp.Connection, name string) (bool, error) {
+	rabbitChan, err := conn.Channel()
+	if err != nil {
+		return false, fmt.Errorf("Failed to create RabbitMQ channel: %v", err)
+	}
+	// the queue belongs to the connection, not the channel
+	defer rabbitChan.Close()
+
+	_, err = rabbitChan.QueueDeclare(name, false, false, true, false, nil)
+	var amqpErr *amqp.Error
+	if errors.As(err, &amqpErr) && amqpErr.Code == amqp.ResourceLocked {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("Failed to declare queue: %v", err)
+	}
+	return true, nil
+}
+
+func subscribeBatch[T any](
+	conn *amqp.Connection,
+	exchange,
+	queueName,
+	key string,
+	queueType SimpleQueueType,
+	batchSize int,
+	interval time.Duration,
+	handler func([]T) []AckType,
+	unmarshaller func([]byte) (T, error),
+	opts []SubscribeOption,
+) error {
+	o := newSubscribeOptions(opts)
+
+	if batchSize < 1 {
+		return fmt.Errorf("Batch size must be at least 1, got %d", batchSize)
+	}
+	if interval <= 0 {
+		return fmt.Errorf("Batch interval must be positive, got %v", interval)
+	}
+
+	rabbitChan, queue, err := DeclareAndBind(conn, exchange, queueName, key, queueType)
+	if err != nil {
+		return fmt.Errorf("Failed to declare and bind queue: %v", err)
+	}
+
+	// prefetch two batches so the next one fills while the handler runs
+	if err = rabbitChan.Qos(batchSize*2, 0, false); err != nil {
+		return fmt.Errorf("Error configuring prefetch count: %v", err)
+	}
+
+	deliveryChan, err := rabbitChan.Consume(queue.Name, "", false, false, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("Error consuming queue: %v", err)
+	}
+
+	go func() {
+		defer rabbitChan.Close()
+
+		deliveries := make([]amqp.Delivery, 0, batchSize)
+		targets := make([]T, 0, batchSize)
+		spans := make([]*tracing.Span, 0, batchSize)
+		flush := func() {
+			if len(deliveries) == 0 {
+				return
+			}
+			start := time.Now()
+			acks := handler(targets)
+			timeHandler(exchange, key, start)
+			settleBatch(deliveries, acks, exchange, key)
+			for i, span := range spans {
+				span.SetAttribute("batch_size", strconv.Itoa(len(spans)))
+				if len(acks) == len(spans) {
+					span.SetAttribute("outcome", acks[i].String())
+				}
+				span.End()
+			}
+			deliveries = deliveries[:0]
+			targets = targets[:0]
+			spans = spans[:0]
+		}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case delivery, ok := <-deliveryChan:
+				if !ok {
+					flush()
+					return
+				}
+				recordConsume(exchange, key)
+				_, span := startConsumeSpan(key, queueName, delivery)
+				target, err := unmarshaller(delivery.Body)
+				if err != nil {
+					deliveryLogger(delivery).Warn("could not unmarshal message", "err", err)
+					delivery.Nack(false, false)
+					recordSettle(exchange, key, outcomeMalformed)
+					span.SetError(err)
+					span.End()
+					continue
+				}
+				if err = o.check(delivery, target); err != nil {
+					deliveryLogger(delivery).Warn("rejected message", "err", err)
+					delivery.Nack(false, false)
+					recordSettle(exchange, key, outcomeRejected)
+					span.SetError(err)
+					span.End()
+					continue
+				}
+				deliveries = append(deliveries, delivery)
+				targets = append(targets, target)
+				spans = append(spans, span)
+				if len(deliveries) >= batchSize {
+					flush()
+				}
+			case <-ticker.C:
+				flush()
+			}
+		}
+	}()
+
+	return nil
+}
+
+// settleBatch nacks the messages the handler rejected one by one, then acks
+// everything else up to the last accepted message with a single multiple-ack.
+func settleBatch(deliveries []amqp.Delivery, acks []AckType, exchange, binding string) {
+	if len(acks) != len(deliveries) {
+		slog.Error("batch handler returned wrong number of acks, requeueing batch", "acks", len(acks), "messages", len(deliveries))
+		deliveries[len(deliveries)-1].Nack(true, true)
+		for range deliveries {
+			recordSettle(exchange, binding, NackRequeue.String())
+		}
+		return
+	}
+
+	lastAck := -1
+	for i, ack := range acks {
+		switch ack {
+		case Ack:
+			lastAck = i
+		case NackRequeue:
+			deliveries[i].Nack(false, true)
+		case NackDiscard:
+			deliveries[i].Nack(false, false)
+		default:
+			deliveryLogger(deliveries[i]).Error("unknown ack type, requeueing", "ack", int(ack))
+			deliveries[i].Nack(false, true)
+			ack = NackRequeue
+		}
+		recordSettle(exchange, binding, ack.String())
+	}
+	if lastAck >= 0 {
+		deliveries[lastAck].Ack(true)
+	}
+}
@@ -0,0 +1,191 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// replyToQueue is RabbitMQ's direct reply-to pseudo-queue. Replies sent to it
+// go straight to the consumer that published the request.
+const replyToQueue = "amq.rabbitmq.reply-to"
+
+type requestOptions struct {
+	publish  []PublishOption
+	verifier Verifier
+}
+
+type RequestOption func(*requestOptions)
+
+// WithRequestSigner signs the request.
+func WithRequestSigner(s *Signer) RequestOption {
+	return func(o *requestOptions) {
+		o.publish = append(o.publish, WithSigner(s))
+	}
+}
+
+// WithReplyVerifier rejects replies that v doesn't accept.
+func WithReplyVerifier(v Verifier) RequestOption {
+	return func(o *requestOptions) {
+		o.verifier = v
+	}
+}
+
+// RequestJSON publishes req and waits up to timeout for the reply from a
+// SubscribeJSONRPC handler.
+func RequestJSON[Req, Resp any](conn *amqp.Connection, exchange, key string, req Req, timeout time.Duration, opts ...RequestOption) (Resp, error) {
+	var resp Resp
+	o := requestOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	rabbitChan, err := conn.Channel()
+	if err != nil {
+		return resp, fmt.Errorf("Failed to create RabbitMQ channel: %v", err)
+	}
+	defer rabbitChan.Close()
+
+	// the reply-to consumer must exist before the request is published
+	replies, err := rabbitChan.Consume(replyToQueue, "", true, false, false, false, nil)
+	if err != nil {
+		return resp, fmt.Errorf("Error consuming replies: %v", err)
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return resp, fmt.Errorf("Error marshalling to JSON: %v", err)
+	}
+	correlationID := fmt.Sprintf("%d", time.Now().UnixNano())
+	p := amqp.Publishing{
+		ContentType:   "application/json",
+		CorrelationId: correlationID,
+		MessageId:     NewMessageID(),
+		ReplyTo:       replyToQueue,
+		Body:          body,
+	}
+	for _, opt := range o.publish {
+		opt(key, &p)
+	}
+	// the span covers the wait for the reply too
+	span := startPublishSpan(exchange, key, &p)
+	defer span.End()
+	err = rabbitChan.PublishWithContext(context.Background(), exchange, key, false, false, p)
+	recordPublish(exchange, key, err)
+	if err != nil {
+		span.SetError(err)
+		return resp, fmt.Errorf("Error publishing request: %v", err)
+	}
+
+	deadline := time.After(timeout)
+	for {
+		select {
+		case reply, ok := <-replies:
+			if !ok {
+				err = fmt.Errorf("Channel closed while waiting for reply")
+				span.SetError(err)
+				return resp, err
+			}
+			if reply.CorrelationId != correlationID {
+				continue
+			}
+			if o.verifier != nil {
+				if _, err = o.verifier.Verify(reply); err != nil {
+					span.SetError(err)
+					return resp, fmt.Errorf("Rejected reply: %v", err)
+				}
+			}
+			if err = json.Unmarshal(reply.Body, &resp); err != nil {
+				span.SetError(err)
+				return resp, fmt.Errorf("Could not unmarshall reply: %v", err)
+			}
+			return resp, nil
+		case <-deadline:
+			err = fmt.Errorf("No reply after %v", timeout)
+			span.SetError(err)
+			return resp, err
+		}
+	}
+}
+
+// SubscribeJSONRPC is like SubscribeJSON, but the handler also returns a
+// reply, which is sent to the requester if the request asked for one.
+// Requests WithVerifier rejects get no reply.
+func SubscribeJSONRPC[Req, Resp any](
+	conn *amqp.Connection,
+	exchange,
+	queueName,
+	key string,
+	queueType SimpleQueueType,
+	handler func(Req) (Resp, AckType),
+	opts ...SubscribeOption,
+) error {
+	o := newSubscribeOptions(opts)
+
+	rabbitChan, queue, err := DeclareAndBind(conn, exchange, queueName, key, queueType)
+	if err != nil {
+		return fmt.Errorf("Failed to declare and bind queue: %v", err)
+	}
+
+	if err = rabbitChan.Qos(10, 0, false); err != nil {
+		return fmt.Errorf("Error configuring prefetch count: %v", err)
+	}
+
+	deliveryChan, err := rabbitChan.Consume(queue.Name, "", false, false, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("Error consuming queue: %v", err)
+	}
+
+	go func() {
+		defer rabbitChan.Close()
+		for delivery := range deliveryChan {
+			recordConsume(exchange, key)
+			_, span := startConsumeSpan(key, queueName, delivery)
+			var req Req
+			if err := json.Unmarshal(delivery.Body, &req); err != nil {
+				deliveryLogger(delivery).Warn("could not unmarshal request", "err", err)
+				delivery.Nack(false, false)
+				recordSettle(exchange, key, outcomeMalformed)
+				span.SetError(err)
+				span.End()
+				continue
+			}
+			if err := o.check(delivery, req); err != nil {
+				deliveryLogger(delivery).Warn("rejected request", "err", err)
+				delivery.Nack(false, false)
+				recordSettle(exchange, key, outcomeRejected)
+				span.SetError(err)
+				span.End()
+				continue
+			}
+
+			start := time.Now()
+			resp, ack := handler(req)
+			timeHandler(exchange, key, start)
+			if delivery.ReplyTo != "" {
+				body, err := json.Marshal(resp)
+				if err == nil {
+					reply := amqp.Publishing{
+						ContentType:   "application/json",
+						CorrelationId: delivery.CorrelationId,
+						Body:          body,
+					}
+					WithSigner(o.replySigner)(delivery.ReplyTo, &reply)
+					err = rabbitChan.PublishWithContext(context.Background(), "", delivery.ReplyTo, false, false, reply)
+				}
+				if err != nil {
+					deliveryLogger(delivery).Error("could not send reply", "err", err)
+				}
+			}
+
+			settle(delivery, ack, exchange, key)
+			span.SetAttribute("outcome", ack.String())
+			span.End()
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package pubsub
+
+import (
+	"sync"
+	"time"
+)
+
+// TokenBucket allows bursts of up to burst events, refilled at rate events
+// per second.
+type TokenBucket struct {
+	mu     *sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket returns a full bucket. A rate of zero or less never limits,
+// and a burst below one is raised to one, since the bucket could otherwise
+// never refill to a whole token.
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	burst = max(burst, 1)
+	return &TokenBucket{
+		mu:     &sync.Mutex{},
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// reserve takes a token if one is available, or returns how long until one
+// will be. The caller must hold tb.mu.
+func (tb *TokenBucket) reserve(now time.Time) time.Duration {
+	if tb.rate <= 0 {
+		return 0
+	}
+	tb.tokens += now.Sub(tb.last).Seconds() * tb.rate
+	if tb.tokens > tb.burst {
+		tb.tokens = tb.burst
+	}
+	tb.last = now
+	if tb.tokens >= 1 {
+		tb.tokens--
+		return 0
+	}
+	return time.Duration((1 - tb.tokens) / tb.rate * float64(time.Second))
+}
+
+// full reports whether the bucket will have refilled completely by now. The
+// caller must hold tb.mu.
+func (tb *TokenBucket) full(now time.Time) bool {
+	return tb.rate <= 0 || tb.tokens+now.Sub(tb.last).Seconds()*tb.rate >= tb.burst
+}
+
+// Full reports whether the bucket has refilled completely, so it behaves
+// exactly like a new one and need not be kept.
+func (tb *TokenBucket) Full() bool {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	return tb.full(time.Now())
+}
+
+// Allow reports whether an event may happen now, taking a token if so.
+func (tb *TokenBucket) Allow() bool {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	return tb.reserve(time.Now()) == 0
+}
+
+// Wait blocks until a token is available and takes it.
+func (tb *TokenBucket) Wait() {
+	for {
+		tb.mu.Lock()
+		wait := tb.reserve(time.Now())
+		tb.mu.Unlock()
+		if wait == 0 {
+			return
+		}
+		time.Sleep(wait)
+	}
+}
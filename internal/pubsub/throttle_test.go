@@ -0,0 +1,66 @@
+package pubsub
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucketBurstThenRefill(t *testing.T) {
+	tb := NewTokenBucket(2, 3)
+	now := tb.last
+
+	for i := 0; i < 3; i++ {
+		if wait := tb.reserve(now); wait != 0 {
+			t.Fatalf("event %d of the burst waited %v", i+1, wait)
+		}
+	}
+	if wait := tb.reserve(now); wait != 500*time.Millisecond {
+		t.Fatalf("wait after the burst = %v, want 500ms", wait)
+	}
+	if tb.full(now) {
+		t.Fatal("emptied bucket reported full")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if wait := tb.reserve(now); wait != 0 {
+		t.Fatalf("wait after refilling one token = %v, want 0", wait)
+	}
+
+	now = now.Add(10 * time.Second)
+	if !tb.full(now) {
+		t.Fatal("bucket not full after a long idle period")
+	}
+	for i := 0; i < 3; i++ {
+		if wait := tb.reserve(now); wait != 0 {
+			t.Fatalf("refill exceeded the burst: event %d waited %v", i+1, wait)
+		}
+	}
+	if wait := tb.reserve(now); wait == 0 {
+		t.Fatal("refill allowed more than the burst")
+	}
+}
+
+func TestTokenBucketBurstBelowOne(t *testing.T) {
+	tb := NewTokenBucket(1, 0)
+	now := tb.last
+	if wait := tb.reserve(now); wait != 0 {
+		t.Fatalf("first event waited %v", wait)
+	}
+	now = now.Add(time.Second)
+	if wait := tb.reserve(now); wait != 0 {
+		t.Fatalf("event after refilling waited %v, want 0", wait)
+	}
+}
+
+func TestTokenBucketZeroRateNeverLimits(t *testing.T) {
+	tb := NewTokenBucket(0, 1)
+	now := tb.last
+	for i := 0; i < 100; i++ {
+		if wait := tb.reserve(now); wait != 0 {
+			t.Fatalf("event %d waited %v", i+1, wait)
+		}
+	}
+	if !tb.full(now) {
+		t.Fatal("unlimited bucket reported not full")
+	}
+}
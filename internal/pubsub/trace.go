@@ -0,0 +1,51 @@
+package pubsub
+
+import (
+	"context"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/tracing"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// WithContext makes the span in ctx, usually the handler span of the message
+// being handled, the parent of the message's publish span. Without it every
+// publish starts a new trace.
+func WithContext(ctx context.Context) PublishOption {
+	return func(key string, p *amqp.Publishing) {
+		if s := tracing.FromContext(ctx); s != nil {
+			setTraceparent(p, s.Traceparent())
+		}
+	}
+}
+
+func setTraceparent(p *amqp.Publishing, traceparent string) {
+	if p.Headers == nil {
+		p.Headers = amqp.Table{}
+	}
+	p.Headers[tracing.TraceparentHeader] = traceparent
+}
+
+func traceparent(headers amqp.Table) string {
+	tp, _ := headers[tracing.TraceparentHeader].(string)
+	return tp
+}
+
+// startPublishSpan starts the producer span for a message about to be
+// published and injects it into the message's headers.
+func startPublishSpan(exchange, key string, p *amqp.Publishing) *tracing.Span {
+	_, span := tracing.StartRemote(context.Background(), "publish "+key, traceparent(p.Headers))
+	span.SetAttribute("exchange", exchange)
+	span.SetAttribute("routing_key", key)
+	setTraceparent(p, span.Traceparent())
+	return span
+}
+
+// startConsumeSpan starts the span a handler runs in, as a child of the span
+// that published d.
+func startConsumeSpan(binding, queueName string, d amqp.Delivery) (context.Context, *tracing.Span) {
+	ctx, span := tracing.StartRemote(context.Background(), "consume "+binding, traceparent(d.Headers))
+	span.SetAttribute("exchange", d.Exchange)
+	span.SetAttribute("routing_key", d.RoutingKey)
+	span.SetAttribute("queue", queueName)
+	return ctx, span
+}
@@ -1,13 +1,188 @@
 package routing
 
-import "time"
+import (
+	"crypto/ed25519"
+	"time"
 
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+)
+
+// PlayingState announces a pause or resume. A zero ResumeAt means the pause
+// lasts until the server resumes it. A state that is not paused but starts in
+// the future announces a scheduled pause.
 type PlayingState struct {
-	IsPaused bool
+	IsPaused  bool
+	Reason    string
+	StartedAt time.Time
+	ResumeAt  time.Time
+}
+
+// IsScheduled reports whether ps announces a pause that hasn't started yet.
+func (ps PlayingState) IsScheduled() bool {
+	return !ps.IsPaused && ps.StartedAt.After(time.Now())
 }
 
+const (
+	LogEventMessage   = "message"
+	LogEventWar       = "war"
+	LogEventDiplomacy = "diplomacy"
+	LogEventGameOver  = "game_over"
+	LogEventImported  = "imported"
+)
+
+// Default per-player limits on game logs. The server drops logs over the
+// limit and clients throttle themselves to stay under it.
+const (
+	GameLogRate  = 5
+	GameLogBurst = 20
+)
+
+// GameLog.ID identifies a log across redeliveries so the server can drop
+// duplicates. Publishers fill it in with pubsub.NewMessageID.
 type GameLog struct {
+	ID          string
 	CurrentTime time.Time
 	Message     string
 	Username    string
+	GameID      string
+	Event       string
+}
+
+func (gl GameLog) ClaimedBy() string {
+	return gl.Username
+}
+
+type Standing struct {
+	Username  string
+	Score     int
+	Locations int
+	Units     int
+}
+
+type GameOver struct {
+	Winner    string
+	Reason    string
+	Standings []Standing
+	EndedAt   time.Time
+}
+
+type GameInfo struct {
+	ID      string
+	Players []string
+	Victory string
+	Paused  bool
+	Over    bool
+}
+
+type Lobby struct {
+	Games []GameInfo
+}
+
+type LobbyRequest struct {
+	Username string
+}
+
+const (
+	AdminKick     = "kick"
+	AdminBan      = "ban"
+	AdminAnnounce = "announce"
+)
+
+type AdminMessage struct {
+	Action  string
+	Message string
+	Time    time.Time
+}
+
+// Registration claims a username before entering the lobby. Password is
+// optional; the first registration with one reserves the name for good.
+type Registration struct {
+	Username string
+	Password string
+}
+
+// RegistrationResult carries the server's public key, which everything the
+// server sends and the certificates it issues are verified with. KeyID is
+// chosen by the server to identify this registration and must be used to
+// join games.
+type RegistrationResult struct {
+	Accepted  bool
+	Reason    string
+	KeyID     string
+	ServerKey ed25519.PublicKey
+}
+
+// JoinGame is a request to join a game. The server replies with a
+// JoinResult whose Certificate vouches for PublicKey, the key the player
+// signs their messages with. KeyID must be the one the player registered
+// with.
+type JoinGame struct {
+	GameID    string
+	Username  string
+	KeyID     string
+	PublicKey ed25519.PublicKey
+}
+
+type JoinResult struct {
+	Accepted    bool
+	Reason      string
+	Certificate pubsub.Certificate
+}
+
+const (
+	PresenceJoined       = "joined"
+	PresenceHeartbeat    = "heartbeat"
+	PresenceLeft         = "left"
+	PresenceDisconnected = "disconnected"
+)
+
+// HeartbeatInterval is how often clients report that they are still
+// connected.
+const HeartbeatInterval = 5 * time.Second
+
+type Presence struct {
+	GameID   string
+	Username string
+	Status   string
+	Time     time.Time
+}
+
+func (p Presence) ClaimedBy() string {
+	return p.Username
+}
+
+type RosterEntry struct {
+	Username  string
+	LastSeen  time.Time
+	Connected bool
+}
+
+// ChatMessage is sent to everyone in the game unless To names a single
+// recipient.
+type ChatMessage struct {
+	GameID  string
+	From    string
+	To      string
+	Message string
+	Time    time.Time
+	History bool
+}
+
+func (m ChatMessage) ClaimedBy() string {
+	return m.From
+}
+
+const (
+	ReviewKindGameLog = "game_log"
+	ReviewKindChat    = "chat"
+)
+
+// ModerationReview is a rejected message waiting for a moderator.
+type ModerationReview struct {
+	Kind     string
+	GameID   string
+	Username string
+	Message  string
+	Reason   string
+	Time     time.Time
 }
@@ -1,16 +1,212 @@
 package routing
 
+import "strings"
+
 const (
 	ArmyMovesPrefix = "army_moves"
 
+	ArmyMoveViewsPrefix = "army_move_views"
+
 	WarRecognitionsPrefix = "war"
 
-	PauseKey = "pause"
+	PausePrefix = "pause"
 
 	GameLogSlug = "game_logs"
+
+	PlayerStatePrefix = "player_state"
+
+	SpawnPrefix = "spawn"
+
+	GameOverPrefix = "game_over"
+
+	LobbyPrefix = "lobby"
+
+	PresencePrefix = "presence"
+
+	RosterPrefix = "roster"
+
+	ChatPrefix = "chat"
+
+	ChatDeliveryPrefix = "chat_delivery"
+
+	ChatDirectPrefix = "chat_direct"
+
+	DiplomacyPrefix = "diplomacy"
+
+	ModerationReviewSlug = "moderation_review"
+
+	RegistrationPrefix = "registration"
+
+	AdminPrefix = "admin"
 )
 
 const (
 	ExchangePerilDirect = "peril_direct"
 	ExchangePerilTopic  = "peril_topic"
+	ExchangePerilDLX    = "peril_dlx"
+
+	// ExchangeDefault routes a message to the queue named by its routing
+	// key, and to no other queue.
+	ExchangeDefault = ""
 )
+
+// HostLock is an exclusive queue the hosting server holds for as long as it
+// is connected. The first server to declare it hosts the lobby and every
+// game; servers started while it is held only write game logs.
+const HostLock = "peril_host"
+
+// DeadLetterQueue is the queue bound to ExchangePerilDLX that collects
+// rejected messages.
+const DeadLetterQueue = "peril_dlq"
+
+// LobbyStateKey is where the server broadcasts the list of open games.
+const LobbyStateKey = LobbyPrefix + ".state"
+
+func key(parts ...string) string {
+	return strings.Join(parts, ".")
+}
+
+// ArmyMovesQueue is where players of gameID send their moves, on
+// ExchangeDefault. Only the hosting server can consume it; it sends each
+// other player their view of the move on ArmyMoveViewKey.
+func ArmyMovesQueue(gameID string) string {
+	return HostQueue(ArmyMovesPrefix, gameID)
+}
+
+// ArmyMoveViewKey is where the server sends a player their view of other
+// players' moves.
+func ArmyMoveViewKey(gameID, username string) string {
+	return key(ArmyMoveViewsPrefix, gameID, username)
+}
+
+func WarRecognitionsKey(gameID, username string) string {
+	return key(WarRecognitionsPrefix, gameID, username)
+}
+
+func WarRecognitionsBinding(gameID string) string {
+	return key(WarRecognitionsPrefix, gameID, "*")
+}
+
+func PauseKey(gameID string) string {
+	return key(PausePrefix, gameID)
+}
+
+func GameLogKey(gameID, username string) string {
+	return key(GameLogSlug, gameID, username)
+}
+
+// GameLogBinding matches game logs from every game.
+func GameLogBinding() string {
+	return key(GameLogSlug, "*", "*")
+}
+
+// PlayerStateKey is where the server sends a player its record of their
+// army on the direct exchange.
+func PlayerStateKey(gameID, username string) string {
+	return key(PlayerStatePrefix, gameID, username)
+}
+
+// SpawnQueue is where players of gameID ask the hosting server for new
+// units, on ExchangeDefault.
+func SpawnQueue(gameID string) string {
+	return HostQueue(SpawnPrefix, gameID)
+}
+
+func GameOverKey(gameID string) string {
+	return key(GameOverPrefix, gameID)
+}
+
+func LobbyRequestKey(username string) string {
+	return key(LobbyPrefix, "request", username)
+}
+
+func LobbyRequestBinding() string {
+	return key(LobbyPrefix, "request", "*")
+}
+
+// LobbyJoinQueue is where players send join requests, on ExchangeDefault.
+// Only the hosting server can consume it, so nobody else sees the key IDs
+// the requests carry.
+func LobbyJoinQueue() string {
+	return HostQueue(LobbyPrefix, "joins")
+}
+
+// AdminKey is where the server sends admin messages, such as kicks, to a
+// single player on the direct exchange.
+func AdminKey(username string) string {
+	return key(AdminPrefix, "player", username)
+}
+
+// AdminBroadcastKey is where the server sends announcements to every player.
+func AdminBroadcastKey() string {
+	return key(AdminPrefix, "broadcast")
+}
+
+// RegistrationQueue is where players register, on ExchangeDefault. Only the
+// hosting server can consume it, so nobody else sees their passwords.
+func RegistrationQueue() string {
+	return HostQueue(RegistrationPrefix)
+}
+
+func PresenceKey(gameID, username string) string {
+	return key(PresencePrefix, gameID, username)
+}
+
+func PresenceBinding(gameID string) string {
+	return key(PresencePrefix, gameID, "*")
+}
+
+func RosterKey(gameID string) string {
+	return key(RosterPrefix, gameID)
+}
+
+// ChatKey is where players send chat messages for the server to relay.
+func ChatKey(gameID, username string) string {
+	return key(ChatPrefix, gameID, username)
+}
+
+func ChatBinding(gameID string) string {
+	return key(ChatPrefix, gameID, "*")
+}
+
+// ChatBroadcastKey is where the server relays messages for everyone in a
+// game.
+func ChatBroadcastKey(gameID string) string {
+	return key(ChatDeliveryPrefix, gameID)
+}
+
+// ChatDirectKey is where the server relays whispers and chat history for a
+// single player.
+func ChatDirectKey(gameID, username string) string {
+	return key(ChatDirectPrefix, gameID, username)
+}
+
+func DiplomacyKey(gameID, username string) string {
+	return key(DiplomacyPrefix, gameID, username)
+}
+
+func DiplomacyBinding(gameID string) string {
+	return key(DiplomacyPrefix, gameID, "*")
+}
+
+func ModerationReviewKey(gameID, username string) string {
+	return key(ModerationReviewSlug, gameID, username)
+}
+
+// ModerationReviewBinding matches rejected messages from every game.
+func ModerationReviewBinding() string {
+	return key(ModerationReviewSlug, "*", "*")
+}
+
+// HostQueue names a queue only the hosting server consumes, e.g.
+// HostQueue("chat", gameID). Host queues are exclusive, so their fixed names
+// also stop a second server from consuming them.
+func HostQueue(parts ...string) string {
+	return key(append([]string{HostLock}, parts...)...)
+}
+
+// QueueName builds a queue name from its parts, e.g. QueueName("pause",
+// gameID, username).
+func QueueName(parts ...string) string {
+	return key(parts...)
+}
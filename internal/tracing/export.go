@@ -0,0 +1,102 @@
+package tracing
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// SpanData is a finished span as it is exported.
+type SpanData struct {
+	Name     string            `json:"name"`
+	TraceID  string            `json:"trace_id"`
+	SpanID   string            `json:"span_id"`
+	ParentID string            `json:"parent_id,omitempty"`
+	Start    time.Time         `json:"start"`
+	Duration time.Duration     `json:"duration_ns"`
+	Attrs    map[string]string `json:"attrs,omitempty"`
+	Error    string            `json:"error,omitempty"`
+}
+
+// Exporter receives finished spans. Export must be safe to call from
+// several goroutines.
+type Exporter interface {
+	Export(SpanData)
+}
+
+var (
+	exporterMu = &sync.RWMutex{}
+	exporter   Exporter
+)
+
+// SetExporter sends finished spans to e. With no exporter spans are still
+// propagated but dropped when they end.
+func SetExporter(e Exporter) {
+	exporterMu.Lock()
+	defer exporterMu.Unlock()
+	exporter = e
+}
+
+func export(data SpanData) {
+	exporterMu.RLock()
+	e := exporter
+	exporterMu.RUnlock()
+	if e != nil {
+		e.Export(data)
+	}
+}
+
+// WriterExporter writes each span as a line of JSON.
+type WriterExporter struct {
+	mu *sync.Mutex
+	w  *bufio.Writer
+	c  io.Closer
+}
+
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{mu: &sync.Mutex{}, w: bufio.NewWriter(w)}
+}
+
+// OpenExporter exports to path, appending to it if it exists. A path of "-"
+// means standard output.
+func OpenExporter(path string) (*WriterExporter, error) {
+	if path == "-" {
+		return NewWriterExporter(os.Stdout), nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open %s: %v", path, err)
+	}
+	e := NewWriterExporter(f)
+	e.c = f
+	return e, nil
+}
+
+func (e *WriterExporter) Export(data SpanData) {
+	line, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.w.Write(line)
+	e.w.WriteByte('\n')
+	e.w.Flush()
+}
+
+// Close flushes the exporter and closes the file it writes to, if any.
+func (e *WriterExporter) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.w.Flush(); err != nil {
+		return err
+	}
+	if e.c != nil {
+		return e.c.Close()
+	}
+	return nil
+}
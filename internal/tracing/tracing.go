@@ -0,0 +1,182 @@
+// Package tracing propagates W3C trace context between processes and
+// exports finished spans as JSON lines.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceparentHeader is the W3C header carrying the trace and parent span IDs.
+const TraceparentHeader = "traceparent"
+
+// SpanContext identifies a span across process boundaries.
+type SpanContext struct {
+	TraceID string
+	SpanID  string
+	Sampled bool
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != "" && sc.SpanID != ""
+}
+
+// Traceparent formats sc as a version 00 traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID, sc.SpanID, flags)
+}
+
+// ParseTraceparent parses a traceparent header value. Unknown versions are
+// read as version 00, as the specification asks.
+func ParseTraceparent(s string) (SpanContext, bool) {
+	parts := strings.Split(s, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return SpanContext{}, false
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return SpanContext{}, false
+	}
+	traceID, spanID, flags := parts[1], parts[2], parts[3]
+	if !isHex(traceID, 32) || !isHex(spanID, 16) || !isHex(flags, 2) {
+		return SpanContext{}, false
+	}
+	if traceID == strings.Repeat("0", 32) || spanID == strings.Repeat("0", 16) {
+		return SpanContext{}, false
+	}
+	b, _ := hex.DecodeString(flags)
+	return SpanContext{TraceID: traceID, SpanID: spanID, Sampled: b[0]&1 == 1}, true
+}
+
+func isHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return true
+}
+
+func newID(bytes int) string {
+	b := make([]byte, bytes)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Span is a timed operation within a trace.
+type Span struct {
+	mu       *sync.Mutex
+	name     string
+	sc       SpanContext
+	parentID string
+	start    time.Time
+	attrs    map[string]string
+	err      string
+	ended    bool
+}
+
+type spanKey struct{}
+
+// FromContext returns the span in ctx, or nil.
+func FromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// Start begins a span that is a child of the span in ctx, or the root of a
+// new trace if there isn't one.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	var parent SpanContext
+	if s := FromContext(ctx); s != nil {
+		parent = s.sc
+	}
+	return start(ctx, name, parent)
+}
+
+// StartRemote begins a span whose parent is described by a traceparent
+// header received from another process. An empty or invalid header starts a
+// new trace.
+func StartRemote(ctx context.Context, name, traceparent string) (context.Context, *Span) {
+	parent, _ := ParseTraceparent(traceparent)
+	return start(ctx, name, parent)
+}
+
+func start(ctx context.Context, name string, parent SpanContext) (context.Context, *Span) {
+	s := &Span{
+		mu:    &sync.Mutex{},
+		name:  name,
+		start: time.Now(),
+		attrs: map[string]string{},
+		sc:    SpanContext{SpanID: newID(8), Sampled: true},
+	}
+	if parent.IsValid() {
+		s.sc.TraceID = parent.TraceID
+		s.sc.Sampled = parent.Sampled
+		s.parentID = parent.SpanID
+	} else {
+		s.sc.TraceID = newID(16)
+	}
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+func (s *Span) Context() SpanContext {
+	return s.sc
+}
+
+// Traceparent is the header value that makes s the parent of a span in
+// another process.
+func (s *Span) Traceparent() string {
+	return s.sc.Traceparent()
+}
+
+func (s *Span) SetAttribute(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attrs[key] = value
+}
+
+// SetError marks the span as failed. A nil err is ignored.
+func (s *Span) SetError(err error) {
+	if err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err.Error()
+}
+
+// End finishes the span and hands it to the exporter. Only the first call
+// has any effect.
+func (s *Span) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	data := SpanData{
+		Name:     s.name,
+		TraceID:  s.sc.TraceID,
+		SpanID:   s.sc.SpanID,
+		ParentID: s.parentID,
+		Start:    s.start,
+		Duration: time.Since(s.start),
+		Attrs:    s.attrs,
+		Error:    s.err,
+	}
+	s.mu.Unlock()
+	if s.sc.Sampled {
+		export(data)
+	}
+}
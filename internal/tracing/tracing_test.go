@@ -0,0 +1,72 @@
+package tracing
+
+import "testing"
+
+const (
+	testTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	testSpanID  = "00f067aa0ba902b7"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   SpanContext
+		ok     bool
+	}{
+		{
+			name:   "sampled",
+			header: "00-" + testTraceID + "-" + testSpanID + "-01",
+			want:   SpanContext{TraceID: testTraceID, SpanID: testSpanID, Sampled: true},
+			ok:     true,
+		},
+		{
+			name:   "not sampled",
+			header: "00-" + testTraceID + "-" + testSpanID + "-00",
+			want:   SpanContext{TraceID: testTraceID, SpanID: testSpanID},
+			ok:     true,
+		},
+		{
+			name:   "other flags are ignored",
+			header: "00-" + testTraceID + "-" + testSpanID + "-03",
+			want:   SpanContext{TraceID: testTraceID, SpanID: testSpanID, Sampled: true},
+			ok:     true,
+		},
+		{
+			name:   "future version with extra fields",
+			header: "cc-" + testTraceID + "-" + testSpanID + "-01-what-the-future-holds",
+			want:   SpanContext{TraceID: testTraceID, SpanID: testSpanID, Sampled: true},
+			ok:     true,
+		},
+		{name: "empty", header: ""},
+		{name: "invalid version", header: "ff-" + testTraceID + "-" + testSpanID + "-01"},
+		{name: "version 00 with extra fields", header: "00-" + testTraceID + "-" + testSpanID + "-01-extra"},
+		{name: "missing flags", header: "00-" + testTraceID + "-" + testSpanID},
+		{name: "short trace ID", header: "00-" + testTraceID[1:] + "-" + testSpanID + "-01"},
+		{name: "short span ID", header: "00-" + testTraceID + "-" + testSpanID[1:] + "-01"},
+		{name: "uppercase hex", header: "00-4BF92F3577B34DA6A3CE929D0E0E4736-" + testSpanID + "-01"},
+		{name: "zero trace ID", header: "00-00000000000000000000000000000000-" + testSpanID + "-01"},
+		{name: "zero span ID", header: "00-" + testTraceID + "-0000000000000000-01"},
+		{name: "non-hex flags", header: "00-" + testTraceID + "-" + testSpanID + "-0x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseTraceparent(tt.header)
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("ParseTraceparent(%q) = %+v, %v, want %+v, %v", tt.header, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestTraceparentRoundTrip(t *testing.T) {
+	for _, sc := range []SpanContext{
+		{TraceID: testTraceID, SpanID: testSpanID, Sampled: true},
+		{TraceID: testTraceID, SpanID: testSpanID},
+	} {
+		got, ok := ParseTraceparent(sc.Traceparent())
+		if !ok || got != sc {
+			t.Errorf("ParseTraceparent(%q) = %+v, %v, want %+v", sc.Traceparent(), got, ok, sc)
+		}
+	}
+}